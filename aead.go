@@ -10,43 +10,67 @@ package aez
 import (
 	"crypto/cipher"
 	"errors"
+	"math"
 )
 
-var errOpen = errors.New("aez: Message authentication failed")
+var (
+	errOpen             = errors.New("aez: Message authentication failed")
+	errInvalidNonceSize = errors.New("aez: Invalid nonce size")
+	errInvalidTagSize   = errors.New("aez: Invalid tag size")
+)
 
 const (
 	aeadNonceSize = 16
 	aeadOverhead  = 16
+
+	// The tag length is encoded as a 32 bit count of bits by AEZ-hash.
+	maxTagSize = math.MaxUint32 / 8
 )
 
-// AeadAEZ is AEZ wrapped in the crypto/cipher.AEAD interface.  It expects
-// a 16 byte nonce, and uses a 16 byte tag, per the recommended defaults in
-// the specification.
+// VectorAEAD is a crypto/cipher.AEAD that additionally can authenticate a
+// vector of additional data.  Each element of the vector is processed as a
+// distinct input to AEZ-hash, so there is no need to unambiguously encode
+// multiple values into a single additional data string.
+type VectorAEAD interface {
+	cipher.AEAD
+
+	// SealVector is Seal, with a vector of additional data.
+	SealVector(dst, nonce, plaintext []byte, additionalData [][]byte) []byte
+
+	// OpenVector is Open, with a vector of additional data.
+	OpenVector(dst, nonce, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+// AeadAEZ is AEZ wrapped in the crypto/cipher.AEAD interface.  Unless
+// constructed via NewWithParams, it expects a 16 byte nonce, and uses a 16
+// byte tag, per the recommended defaults in the specification.
 //
 // The AEZ primitive itself supports a vector of authenticated data, variable
 // length nonces, and variable length authentication tags.  Users who require
-// such functionality should investigate the one-shot Encrypt/Decrypt calls
-// instead.
+// such functionality should investigate the VectorAEAD interface, the Cipher
+// type or the one-shot Encrypt/Decrypt calls instead.
 type AeadAEZ struct {
-	key [extractedKeySize]byte
+	c         Cipher
+	nonceSize int
+	tagSize   int
 }
 
 // NonceSize returns the size of the nonce that must be passed to Seal
 // and Open.
 func (a *AeadAEZ) NonceSize() int {
-	return aeadNonceSize
+	return a.nonceSize
 }
 
 // Overhead returns the maximum difference between the lengths of a
 // plaintext and its ciphertext.
 func (a *AeadAEZ) Overhead() int {
-	return aeadOverhead
+	return a.tagSize
 }
 
 // Reset clears the sensitive keying material from the datastructure such
 // that it will no longer be in memory.
 func (a *AeadAEZ) Reset() {
-	memwipe(a.key[:])
+	a.c.Reset()
 }
 
 // Seal encrypts and authenticates plaintext, authenticates the
@@ -57,19 +81,14 @@ func (a *AeadAEZ) Reset() {
 // however the AEZ primitive does provide nonce-reuse misuse-resistance,
 // see the paper for more details (MRAE).
 func (a *AeadAEZ) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
-	if len(nonce) != aeadNonceSize {
-		panic("aez: incorrect nonce length given to AEZ")
-	}
-
+	// The vector is backed by an array, so that it stays on the stack.
+	var adVec [1][]byte
 	var ad [][]byte
 	if additionalData != nil {
-		ad = append(ad, additionalData)
+		adVec[0] = additionalData
+		ad = adVec[:]
 	}
-	// WARNING: The AEAD interface expects plaintext/dst overlap to be allowed.
-	c := Encrypt(a.key[:], nonce, ad, aeadOverhead, plaintext, nil)
-	dst = append(dst, c...)
-
-	return dst
+	return a.SealVector(dst, nonce, plaintext, ad)
 }
 
 // Open decrypts and authenticates ciphertext, authenticates the
@@ -78,31 +97,70 @@ func (a *AeadAEZ) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 // bytes long and both it and the additional data must match the
 // value passed to Seal.
 func (a *AeadAEZ) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
-	if len(nonce) != aeadNonceSize {
+	// The vector is backed by an array, so that it stays on the stack.
+	var adVec [1][]byte
+	var ad [][]byte
+	if additionalData != nil {
+		adVec[0] = additionalData
+		ad = adVec[:]
+	}
+	return a.OpenVector(dst, nonce, ciphertext, ad)
+}
+
+// SealVector encrypts and authenticates plaintext, authenticates each
+// element of the additional data vector and appends the result to dst,
+// returning the updated slice.  The nonce must be NonceSize() bytes long.
+func (a *AeadAEZ) SealVector(dst, nonce, plaintext []byte, additionalData [][]byte) []byte {
+	if len(nonce) != a.nonceSize {
 		panic("aez: incorrect nonce length given to AEZ")
 	}
 
-	var ad [][]byte
-	if additionalData != nil {
-		ad = append(ad, additionalData)
+	return a.c.e.encrypt(nonce, additionalData, a.tagSize, plaintext, dst)
+}
+
+// OpenVector decrypts and authenticates ciphertext, authenticates each
+// element of the additional data vector and, if successful, appends the
+// resulting plaintext to dst, returning the updated slice.  The nonce must
+// be NonceSize() bytes long and both it and the additional data vector must
+// match the values passed to SealVector.
+func (a *AeadAEZ) OpenVector(dst, nonce, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	if len(nonce) != a.nonceSize {
+		panic("aez: incorrect nonce length given to AEZ")
 	}
-	// WARNING: The AEAD interface expects ciphertext/dst overlap to be allowed.
-	d, ok := Decrypt(a.key[:], nonce, ad, aeadOverhead, ciphertext, nil)
+
+	dst, ok := a.c.e.decrypt(nonce, additionalData, a.tagSize, ciphertext, dst)
 	if !ok {
 		return nil, errOpen
 	}
-	dst = append(dst, d...)
-
 	return dst, nil
 }
 
 // New returns AEZ wrapped in a new cipher.AEAD instance, with the recommended
-// nonce and tag lengths.
+// nonce and tag lengths.  The returned instance also implements VectorAEAD.
 func New(key []byte) (cipher.AEAD, error) {
+	return NewWithParams(key, aeadNonceSize, aeadOverhead)
+}
+
+// NewWithParams returns AEZ wrapped in a new cipher.AEAD instance, with the
+// specified nonce and tag lengths in bytes.  A nonceSize of 0 is permitted
+// and results in deterministic encryption, while the tagSize must be at
+// least 1 byte.  The returned instance also implements VectorAEAD.
+func NewWithParams(key []byte, nonceSize, tagSize int) (cipher.AEAD, error) {
 	if len(key) == 0 {
-		return nil, errors.New("aez: Invalid key size")
+		return nil, errInvalidKeySize
+	}
+	if nonceSize < 0 {
+		return nil, errInvalidNonceSize
 	}
-	a := new(AeadAEZ)
-	extract(key, &a.key)
+	if tagSize < 1 || tagSize > maxTagSize {
+		return nil, errInvalidTagSize
+	}
+	a := &AeadAEZ{
+		nonceSize: nonceSize,
+		tagSize:   tagSize,
+	}
+	a.c.e.init(key)
 	return a, nil
 }
+
+var _ VectorAEAD = (*AeadAEZ)(nil)
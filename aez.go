@@ -19,7 +19,9 @@ package aez
 import (
 	"crypto/subtle"
 	"encoding/binary"
+	"errors"
 	"math"
+	"reflect"
 
 	"golang.org/x/crypto/blake2b"
 )
@@ -33,6 +35,8 @@ const (
 )
 
 var (
+	errInvalidKeySize = errors.New("aez: Invalid key size")
+
 	newAes                aesImplCtor = nil
 	zero                              = [blockSize]byte{}
 	isHardwareAccelerated             = false
@@ -112,6 +116,37 @@ func (e *eState) reset() {
 	e.aes.Reset()
 }
 
+// aes4Slow and aes10Slow call the portable AES round functions directly
+// rather than via the aesImpl interface, so that the arguments, which are
+// frequently on the stack, do not escape to the heap.
+func (e *eState) aes4Slow(j, i, l *[blockSize]byte, src []byte, dst *[blockSize]byte) {
+	// NB: The hardware accelerated case is handled prior to this function.
+	switch a := e.aes.(type) {
+	case *roundB32:
+		a.AES4(j, i, l, src, dst)
+	case *roundB64:
+		a.AES4(j, i, l, src, dst)
+	case *roundVartime:
+		a.AES4(j, i, l, src, dst)
+	default:
+		panic("aez: unsupported AES implementation")
+	}
+}
+
+func (e *eState) aes10Slow(l *[blockSize]byte, src []byte, dst *[blockSize]byte) {
+	// NB: The hardware accelerated case is handled prior to this function.
+	switch a := e.aes.(type) {
+	case *roundB32:
+		a.AES10(l, src, dst)
+	case *roundB64:
+		a.AES10(l, src, dst)
+	case *roundVartime:
+		a.AES10(l, src, dst)
+	default:
+		panic("aez: unsupported AES implementation")
+	}
+}
+
 func multBlock(x uint, src, dst *[blockSize]byte) {
 	var t, r [blockSize]byte
 
@@ -129,6 +164,33 @@ func multBlock(x uint, src, dst *[blockSize]byte) {
 	memwipe(r[:])
 }
 
+// nextJ updates J from xJ to (x+1)J, used to step through the tweak for
+// each element of the additional data vector without calling multBlock for
+// each element, as:
+//
+//   (x+1)J = xJ + sum(2^b J) for each bit b that differs between x and x+1
+//
+// Bit b only changes every 2^b increments, so on average less than one
+// doubling is required per call.
+func (e *eState) nextJ(x uint, J *[blockSize]byte) {
+	var pow [blockSize]byte
+
+	changed := x ^ (x + 1)
+	for b := uint(0); changed != 0; b, changed = b+1, changed>>1 {
+		if b < 3 {
+			xorBytes1x16(J[:], e.J[b][:], J[:]) // 1J, 2J, 4J
+			continue
+		}
+		if b == 3 {
+			copy(pow[:], e.J[2][:])
+		}
+		doubleBlock(&pow) // 2^b J
+		xorBytes1x16(J[:], pow[:], J[:])
+	}
+
+	memwipe(pow[:])
+}
+
 func doubleBlock(p *[blockSize]byte) {
 	tmp := p[0]
 	for i := 0; i < 15; i++ {
@@ -140,7 +202,7 @@ func doubleBlock(p *[blockSize]byte) {
 }
 
 func (e *eState) aezHash(nonce []byte, ad [][]byte, tau int, result []byte) {
-	var buf, sum, I, J [blockSize]byte
+	var buf, sum, J [blockSize]byte
 
 	if len(result) != blockSize {
 		panic("aez: Hash: len(result)")
@@ -148,83 +210,121 @@ func (e *eState) aezHash(nonce []byte, ad [][]byte, tau int, result []byte) {
 
 	// Initialize sum with hash of tau
 	binary.BigEndian.PutUint32(buf[12:], uint32(tau))
-	xorBytes1x16(e.J[0][:], e.J[1][:], J[:])       // J ^ J2
-	e.aes.AES4(&J, &e.I[1], &e.L[1], buf[:], &sum) // E(3,1)
+	xorBytes1x16(e.J[0][:], e.J[1][:], J[:])   // J ^ J2
+	e.aes4(&J, &e.I[1], &e.L[1], buf[:], &sum) // E(3,1)
 
 	// Hash nonce, accumulate into sum
 	empty := len(nonce) == 0
-	n := nonce
-	nBytes := uint(len(nonce))
-	copy(I[:], e.I[1][:])
-	for i := uint(1); nBytes >= blockSize; i, nBytes = i+1, nBytes-blockSize {
-		e.aes.AES4(&e.J[2], &I, &e.L[i%8], n[:blockSize], &buf) // E(4,i)
-		xorBytes1x16(sum[:], buf[:], sum[:])
-		n = n[blockSize:]
-		if i%8 == 0 {
-			doubleBlock(&I)
-		}
-	}
+	nBytes := uint(len(nonce)) % blockSize
+	n := nonce[uint(len(nonce))-nBytes:]
+	e.aezHashBlocks(&e.J[2], nonce[:uint(len(nonce))-nBytes], &sum) // E(4,i)
 	if nBytes > 0 || empty {
 		memwipe(buf[:])
 		copy(buf[:], n)
 		buf[nBytes] = 0x80
-		e.aes.AES4(&e.J[2], &e.I[0], &e.L[0], buf[:], &buf) // E(4,0)
+		e.aes4(&e.J[2], &e.I[0], &e.L[0], buf[:], &buf) // E(4,0)
 		xorBytes1x16(sum[:], buf[:], sum[:])
 	}
 
 	// Hash each vector element, accumulate into sum
+	e.aezHashAD(ad, 0, &sum)
+
+	memwipe(J[:])
+
+	copy(result, sum[:])
+}
+
+// aezHashAD accumulates the hash of each element of the additional data
+// vector into sum, where the first element is at index firstK of the vector.
+func (e *eState) aezHashAD(ad [][]byte, firstK uint, sum *[blockSize]byte) {
+	var buf, J [blockSize]byte
+
 	for k, p := range ad {
-		empty = len(p) == 0
-		bytes := uint(len(p))
-		copy(I[:], e.I[1][:])
-		multBlock(uint(5+k), &e.J[0], &J) // XXX/performance.
-		for i := uint(1); bytes >= blockSize; i, bytes = i+1, bytes-blockSize {
-			e.aes.AES4(&J, &I, &e.L[i%8], p[:blockSize], &buf) // E(5+k,i)
-			xorBytes1x16(sum[:], buf[:], sum[:])
-			p = p[blockSize:]
-			if i%8 == 0 {
-				doubleBlock(&I)
-			}
+		empty := len(p) == 0
+		bytes := uint(len(p)) % blockSize
+		if x := 5 + firstK + uint(k); k == 0 {
+			multBlock(x, &e.J[0], &J)
+		} else {
+			e.nextJ(x-1, &J)
 		}
+		e.aezHashBlocks(&J, p[:uint(len(p))-bytes], sum) // E(5+k,i)
+		p = p[uint(len(p))-bytes:]
 		if bytes > 0 || empty {
 			memwipe(buf[:])
 			copy(buf[:], p)
 			buf[bytes] = 0x80
-			e.aes.AES4(&J, &e.I[0], &e.L[0], buf[:], &buf) // E(5+k,0)
+			e.aes4(&J, &e.I[0], &e.L[0], buf[:], &buf) // E(5+k,0)
 			xorBytes1x16(sum[:], buf[:], sum[:])
 		}
 	}
 
-	memwipe(I[:])
+	memwipe(buf[:])
 	memwipe(J[:])
+}
 
-	copy(result, sum[:])
+// aezHashBlocksSlow accumulates the hash of the full blocks of in, tweaked by
+// J and the index of each block starting from 1, into sum.
+func (e *eState) aezHashBlocksSlow(J *[blockSize]byte, in []byte, sum *[blockSize]byte) {
+	// NB: The hardware accelerated case is handled prior to this function.
+
+	// Use one of the portable bitsliced options if possible.
+	switch a := e.aes.(type) {
+	case *roundB32:
+		a.aezHashBlocks(e, J, in, sum)
+	case *roundB64:
+		a.aezHashBlocks(e, J, in, sum)
+	default:
+		e.aezHashBlocksRef(J, in, sum)
+	}
 }
 
-func (e *eState) aezPRF(delta *[blockSize]byte, tau int, result []byte) {
+func (e *eState) aezHashBlocksRef(J *[blockSize]byte, in []byte, sum *[blockSize]byte) {
+	var buf, I [blockSize]byte
+
+	copy(I[:], e.I[1][:])
+	for i := uint(1); len(in) >= blockSize; i++ {
+		e.aes4(J, &I, &e.L[i%8], in[:blockSize], &buf)
+		xorBytes1x16(sum[:], buf[:], sum[:])
+		in = in[blockSize:]
+		if i%8 == 0 {
+			doubleBlock(&I)
+		}
+	}
+
+	memwipe(buf[:])
+	memwipe(I[:])
+}
+
+func (e *eState) aezPRFSlow(delta *[blockSize]byte, tau int, result []byte) {
+	// NB: The hardware accelerated case is handled prior to this function.
+
+	// Use one of the portable bitsliced options if possible.
+	switch a := e.aes.(type) {
+	case *roundB32:
+		a.aezPRF(e, delta, tau, result)
+	case *roundB64:
+		a.aezPRF(e, delta, tau, result)
+	default:
+		e.aezPRFRef(delta, tau, result)
+	}
+}
+
+func (e *eState) aezPRFRef(delta *[blockSize]byte, tau int, result []byte) {
 	var buf, ctr [blockSize]byte
 
 	off := 0
 	for tau >= blockSize {
 		xorBytes1x16(delta[:], ctr[:], buf[:])
-		e.aes.AES10(&e.L[3], buf[:], &buf) // E(-1,3)
+		e.aes10(&e.L[3], buf[:], &buf) // E(-1,3)
 		copy(result[off:], buf[:])
-
-		i := 15
-		for { // ctr += 1
-			ctr[i]++
-			i--
-			if ctr[i+1] != 0 {
-				break
-			}
-		}
+		incrementCounter(&ctr)
 
 		tau -= blockSize
 		off += blockSize
 	}
 	if tau > 0 {
 		xorBytes1x16(delta[:], ctr[:], buf[:])
-		e.aes.AES10(&e.L[3], buf[:], &buf) // E(-1,3)
+		e.aes10(&e.L[3], buf[:], &buf) // E(-1,3)
 
 		copy(result[off:], buf[:])
 	}
@@ -232,43 +332,55 @@ func (e *eState) aezPRF(delta *[blockSize]byte, tau int, result []byte) {
 	memwipe(buf[:])
 }
 
-func (e *eState) aezCorePass1Slow(in, out []byte, X *[blockSize]byte, sz int) {
+// incrementCounter adds 1 to the 128 bit big endian AEZ-prf counter.
+func incrementCounter(ctr *[blockSize]byte) {
+	i := 15
+	for { // ctr += 1
+		ctr[i]++
+		i--
+		if ctr[i+1] != 0 {
+			break
+		}
+	}
+}
+
+func (e *eState) aezCorePass1Slow(in, out []byte, X, I *[blockSize]byte, sz int) {
 	// NB: The hardware accelerated case is handled prior to this function.
 
 	// Use one of the portable bitsliced options if possible.
 	switch a := e.aes.(type) {
 	case *roundB32:
-		a.aezCorePass1(e, in, out, X, sz)
+		a.aezCorePass1(e, in, out, X, I, sz)
 	case *roundB64:
-		a.aezCorePass1(e, in, out, X, sz)
+		a.aezCorePass1(e, in, out, X, I, sz)
 	default:
-		e.aezCorePass1Ref(in, out, X)
+		e.aezCorePass1Ref(in, out, X, I, sz)
 	}
 }
 
-func (e *eState) aezCorePass2Slow(in, out []byte, Y, S *[blockSize]byte, sz int) {
+func (e *eState) aezCorePass2Slow(in, out []byte, Y, S, I *[blockSize]byte, sz int) {
 	// NB: The hardware accelerated case is handled prior to this function.
 
 	// Use one of the portable bitsliced options if possible.
 	switch a := e.aes.(type) {
 	case *roundB32:
-		a.aezCorePass2(e, out, Y, S, sz)
+		a.aezCorePass2(e, out, Y, S, I, sz)
 	case *roundB64:
-		a.aezCorePass2(e, out, Y, S, sz)
+		a.aezCorePass2(e, out, Y, S, I, sz)
 	default:
-		e.aezCorePass2Ref(in, out, Y, S)
+		e.aezCorePass2Ref(out, Y, S, I, sz)
 	}
 }
 
-func (e *eState) aezCorePass1Ref(in, out []byte, X *[blockSize]byte) {
+func (e *eState) aezCorePass1Ref(in, out []byte, X, initialI *[blockSize]byte, sz int) {
 	var tmp, I [blockSize]byte
 
-	copy(I[:], e.I[1][:])
-	for i, inBytes := uint(1), len(in); inBytes >= 64; i, inBytes = i+1, inBytes-32 {
-		e.aes.AES4(&e.J[0], &I, &e.L[i%8], in[blockSize:blockSize*2], &tmp) // E(1,i)
+	copy(I[:], initialI[:])
+	for i := uint(1); sz > 0; i, sz = i+1, sz-32 {
+		e.aes4(&e.J[0], &I, &e.L[i%8], in[blockSize:blockSize*2], &tmp) // E(1,i)
 		xorBytes1x16(in[:], tmp[:], out[:blockSize])
 
-		e.aes.AES4(&zero, &e.I[0], &e.L[0], out[:blockSize], &tmp) // E(0,0)
+		e.aes4(&zero, &e.I[0], &e.L[0], out[:blockSize], &tmp) // E(0,0)
 		xorBytes1x16(in[blockSize:], tmp[:], out[blockSize:blockSize*2])
 		xorBytes1x16(out[blockSize:], X[:], X[:])
 
@@ -282,25 +394,25 @@ func (e *eState) aezCorePass1Ref(in, out []byte, X *[blockSize]byte) {
 	memwipe(I[:])
 }
 
-func (e *eState) aezCorePass2Ref(in, out []byte, Y, S *[blockSize]byte) {
+func (e *eState) aezCorePass2Ref(out []byte, Y, S, initialI *[blockSize]byte, sz int) {
 	var tmp, I [blockSize]byte
 
-	copy(I[:], e.I[1][:])
-	for i, inBytes := uint(1), len(in); inBytes >= 64; i, inBytes = i+1, inBytes-32 {
-		e.aes.AES4(&e.J[1], &I, &e.L[i%8], S[:], &tmp) // E(2,i)
+	copy(I[:], initialI[:])
+	for i := uint(1); sz > 0; i, sz = i+1, sz-32 {
+		e.aes4(&e.J[1], &I, &e.L[i%8], S[:], &tmp) // E(2,i)
 		xorBytes1x16(out, tmp[:], out[:blockSize])
 		xorBytes1x16(out[blockSize:], tmp[:], out[blockSize:blockSize*2])
 		xorBytes1x16(out, Y[:], Y[:])
 
-		e.aes.AES4(&zero, &e.I[0], &e.L[0], out[blockSize:blockSize*2], &tmp) // E(0,0)
+		e.aes4(&zero, &e.I[0], &e.L[0], out[blockSize:blockSize*2], &tmp) // E(0,0)
 		xorBytes1x16(out, tmp[:], out[:blockSize])
 
-		e.aes.AES4(&e.J[0], &I, &e.L[i%8], out[:blockSize], &tmp) // E(1,i)
+		e.aes4(&e.J[0], &I, &e.L[i%8], out[:blockSize], &tmp) // E(1,i)
 		xorBytes1x16(out[blockSize:], tmp[:], out[blockSize:blockSize*2])
 
 		swapBlocks(&tmp, out)
 
-		in, out = in[32:], out[32:]
+		out = out[32:]
 		if i%8 == 0 {
 			doubleBlock(&I)
 		}
@@ -316,9 +428,8 @@ func oneZeroPad(src []byte, sz int, dst *[blockSize]byte) {
 	dst[sz] = 0x80
 }
 
-func (e *eState) aezCore(delta *[blockSize]byte, in []byte, d uint, out []byte) {
-	var tmp, X, Y, S [blockSize]byte
-	outOrig, inOrig := out, in
+func (e *eState) aezCore(delta *[blockSize]byte, in []byte, d uint, out []byte, workers int) {
+	var X, Y, S [blockSize]byte
 
 	fragBytes := len(in) % 32
 	initialBytes := len(in) - fragBytes - 32
@@ -326,89 +437,119 @@ func (e *eState) aezCore(delta *[blockSize]byte, in []byte, d uint, out []byte)
 	// Compute X and store intermediate results
 	// Pass 1 over in[0:-32], store intermediate values in out[0:-32]
 	if len(in) >= 64 {
-		e.aezCorePass1(in, out, &X, initialBytes)
+		e.aezCorePass1Parallel(in, out, &X, initialBytes, workers)
 	}
 
 	// Finish X calculation
-	in = in[initialBytes:]
+	e.aezCoreFragX(in[initialBytes:initialBytes+fragBytes], &X)
+
+	// Calculate S
+	e.aezCoreS(delta, in[len(in)-32:], d, out[len(in)-32:], &X, &S)
+	// XXX/performance: Early abort if tag is corrupted.
+
+	// Pass 2 over intermediate values in out[32..]. Final values written
+	if len(in) >= 64 {
+		e.aezCorePass2Parallel(in, out, &Y, &S, initialBytes, workers)
+	}
+
+	// Finish Y calculation and finish encryption of fragment bytes
+	e.aezCoreFragY(in[initialBytes:initialBytes+fragBytes], out[initialBytes:], &Y, &S)
+
+	// Finish encryption of last two blocks
+	e.aezCoreFinal(delta, d, out[len(in)-32:], &Y)
+
+	memwipe(X[:])
+	memwipe(Y[:])
+	memwipe(S[:])
+}
+
+func (e *eState) aezCoreFragX(in []byte, X *[blockSize]byte) {
+	var tmp [blockSize]byte
+
+	fragBytes := len(in)
 	if fragBytes >= blockSize {
-		e.aes.AES4(&zero, &e.I[1], &e.L[4], in[:blockSize], &tmp) // E(0,4)
+		e.aes4(&zero, &e.I[1], &e.L[4], in[:blockSize], &tmp) // E(0,4)
 		xorBytes1x16(X[:], tmp[:], X[:])
 		oneZeroPad(in[blockSize:], fragBytes-blockSize, &tmp)
-		e.aes.AES4(&zero, &e.I[1], &e.L[5], tmp[:], &tmp) // E(0,5)
+		e.aes4(&zero, &e.I[1], &e.L[5], tmp[:], &tmp) // E(0,5)
 		xorBytes1x16(X[:], tmp[:], X[:])
 	} else if fragBytes > 0 {
 		oneZeroPad(in, fragBytes, &tmp)
-		e.aes.AES4(&zero, &e.I[1], &e.L[4], tmp[:], &tmp) // E(0,4)
+		e.aes4(&zero, &e.I[1], &e.L[4], tmp[:], &tmp) // E(0,4)
 		xorBytes1x16(X[:], tmp[:], X[:])
 	}
 
-	// Calculate S
-	out, in = outOrig[len(inOrig)-32:], inOrig[len(inOrig)-32:]
-	e.aes.AES4(&zero, &e.I[1], &e.L[(1+d)%8], in[blockSize:2*blockSize], &tmp) // E(0,1+d)
+	memwipe(tmp[:])
+}
+
+func (e *eState) aezCoreS(delta *[blockSize]byte, in []byte, d uint, out []byte, X, S *[blockSize]byte) {
+	var tmp [blockSize]byte
+
+	e.aes4(&zero, &e.I[1], &e.L[(1+d)%8], in[blockSize:2*blockSize], &tmp) // E(0,1+d)
 	xorBytes4x16(X[:], in[:], delta[:], tmp[:], out[:blockSize])
-	e.aes.AES10(&e.L[(1+d)%8], out[:blockSize], &tmp) // E(-1,1+d)
+	e.aes10(&e.L[(1+d)%8], out[:blockSize], &tmp) // E(-1,1+d)
 	xorBytes1x16(in[blockSize:], tmp[:], out[blockSize:blockSize*2])
 	xorBytes1x16(out, out[blockSize:], S[:])
-	// XXX/performance: Early abort if tag is corrupted.
 
-	// Pass 2 over intermediate values in out[32..]. Final values written
-	out, in = outOrig, inOrig
-	if len(in) >= 64 {
-		e.aezCorePass2(in, out, &Y, &S, initialBytes)
-	}
+	memwipe(tmp[:])
+}
 
-	// Finish Y calculation and finish encryption of fragment bytes
-	out, in = out[initialBytes:], in[initialBytes:]
+func (e *eState) aezCoreFragY(in, out []byte, Y, S *[blockSize]byte) {
+	var tmp [blockSize]byte
+
+	fragBytes := len(in)
 	if fragBytes >= blockSize {
-		e.aes.AES10(&e.L[4], S[:], &tmp) // E(-1,4)
+		e.aes10(&e.L[4], S[:], &tmp) // E(-1,4)
 		xorBytes1x16(in, tmp[:], out[:blockSize])
-		e.aes.AES4(&zero, &e.I[1], &e.L[4], out[:blockSize], &tmp) // E(0,4)
+		e.aes4(&zero, &e.I[1], &e.L[4], out[:blockSize], &tmp) // E(0,4)
 		xorBytes1x16(Y[:], tmp[:], Y[:])
 
 		out, in = out[blockSize:], in[blockSize:]
 		fragBytes -= blockSize
 
-		e.aes.AES10(&e.L[5], S[:], &tmp)      // E(-1,5)
+		e.aes10(&e.L[5], S[:], &tmp)          // E(-1,5)
 		xorBytes(in, tmp[:], tmp[:fragBytes]) // non-16 byte xorBytes()
 		copy(out, tmp[:fragBytes])
 		memwipe(tmp[fragBytes:])
 		tmp[fragBytes] = 0x80
-		e.aes.AES4(&zero, &e.I[1], &e.L[5], tmp[:], &tmp) // E(0,5)
+		e.aes4(&zero, &e.I[1], &e.L[5], tmp[:], &tmp) // E(0,5)
 		xorBytes1x16(Y[:], tmp[:], Y[:])
 	} else if fragBytes > 0 {
-		e.aes.AES10(&e.L[4], S[:], &tmp)      // E(-1,4)
+		e.aes10(&e.L[4], S[:], &tmp)          // E(-1,4)
 		xorBytes(in, tmp[:], tmp[:fragBytes]) // non-16 byte xorBytes()
 		copy(out, tmp[:fragBytes])
 		memwipe(tmp[fragBytes:])
 		tmp[fragBytes] = 0x80
-		e.aes.AES4(&zero, &e.I[1], &e.L[4], tmp[:], &tmp) // E(0,4)
+		e.aes4(&zero, &e.I[1], &e.L[4], tmp[:], &tmp) // E(0,4)
 		xorBytes1x16(Y[:], tmp[:], Y[:])
 	}
 
-	// Finish encryption of last two blocks
-	out = outOrig[len(inOrig)-32:]
-	e.aes.AES10(&e.L[(2-d)%8], out[blockSize:], &tmp) // E(-1,2-d)
+	memwipe(tmp[:])
+}
+
+func (e *eState) aezCoreFinal(delta *[blockSize]byte, d uint, out []byte, Y *[blockSize]byte) {
+	var tmp [blockSize]byte
+
+	e.aes10(&e.L[(2-d)%8], out[blockSize:], &tmp) // E(-1,2-d)
 	xorBytes1x16(out, tmp[:], out[:blockSize])
-	e.aes.AES4(&zero, &e.I[1], &e.L[(2-d)%8], out[:blockSize], &tmp) // E(0,2-d)
+	e.aes4(&zero, &e.I[1], &e.L[(2-d)%8], out[:blockSize], &tmp) // E(0,2-d)
 	xorBytes4x16(tmp[:], out[blockSize:], delta[:], Y[:], out[blockSize:])
 	copy(tmp[:], out[:blockSize])
 	copy(out[:blockSize], out[blockSize:])
 	copy(out[blockSize:], tmp[:])
 
-	memwipe(X[:])
-	memwipe(Y[:])
-	memwipe(S[:])
+	memwipe(tmp[:])
 }
 
 func (e *eState) aezTiny(delta *[blockSize]byte, in []byte, d uint, out []byte) {
 	var rounds, i, j uint
 	var buf [2 * blockSize]byte
-	var L, R [blockSize]byte
+	var L, R, roundMask, roundPad [blockSize]byte
 	var step int
 	mask, pad := byte(0x00), byte(0x80)
 	defer memwipe(L[:])
 	defer memwipe(R[:])
+	defer memwipe(roundPad[:])
 
 	var tmp [16]byte
 
@@ -441,30 +582,24 @@ func (e *eState) aezTiny(delta *[blockSize]byte, in []byte, d uint, out []byte)
 			copy(buf[:], in)
 			buf[0] |= 0x80
 			xorBytes1x16(delta[:], buf[:], buf[:blockSize])
-			e.aes.AES4(&zero, &e.I[1], &e.L[3], buf[:blockSize], &tmp) // E(0,3)
+			e.aes4(&zero, &e.I[1], &e.L[3], buf[:blockSize], &tmp) // E(0,3)
 			L[0] ^= (tmp[0] & 0x80)
 		}
 		j, step = rounds-1, -1
 	} else {
 		step = 1
 	}
-	for k := uint(0); k < rounds/2; k, j = k+1, uint(int(j)+2*step) {
-		memwipe(buf[:blockSize])
-		copy(buf[:], R[:(inBytes+1)/2])
-		buf[inBytes/2] = (buf[inBytes/2] & mask) | pad
-		xorBytes1x16(buf[:], delta[:], buf[:blockSize])
-		buf[15] ^= byte(j)
-		e.aes.AES4(&zero, &e.I[1], &e.L[i], buf[:blockSize], &tmp) // E(0,i)
-		xorBytes1x16(L[:], tmp[:], L[:blockSize])
 
-		memwipe(buf[:blockSize])
-		copy(buf[:], L[:(inBytes+1)/2])
-		buf[inBytes/2] = (buf[inBytes/2] & mask) | pad
-		xorBytes1x16(buf[:], delta[:], buf[:blockSize])
-		buf[15] ^= byte(int(j) + step)
-		e.aes.AES4(&zero, &e.I[1], &e.L[i], buf[:blockSize], &tmp) // E(0,i)
-		xorBytes1x16(R[:], tmp[:], R[:blockSize])
+	// Each round enciphers ((half & roundMask) | pad) ^ delta, where
+	// roundMask selects the (inBytes*8)/2 bits of the half.
+	for k := 0; k < inBytes/2; k++ {
+		roundMask[k] = 0xff
 	}
+	roundMask[inBytes/2] = mask
+	roundPad[inBytes/2] = pad
+	xorBytes1x16(roundPad[:], delta[:], roundPad[:])
+	e.aezTinyRounds(&L, &R, &roundMask, &roundPad, i, j, step, rounds)
+
 	copy(buf[:], R[:inBytes/2])
 	copy(buf[inBytes/2:], L[:(inBytes+1)/2])
 	if inBytes&1 != 0 {
@@ -478,14 +613,43 @@ func (e *eState) aezTiny(delta *[blockSize]byte, in []byte, d uint, out []byte)
 		memwipe(buf[inBytes:blockSize])
 		buf[0] |= 0x80
 		xorBytes1x16(delta[:], buf[:], buf[:blockSize])
-		e.aes.AES4(&zero, &e.I[1], &e.L[3], buf[:blockSize], &tmp) // E(0,3)
+		e.aes4(&zero, &e.I[1], &e.L[3], buf[:blockSize], &tmp) // E(0,3)
 		out[0] ^= tmp[0] & 0x80
 	}
 
 	memwipe(tmp[:])
 }
 
-func (e *eState) encipher(delta *[blockSize]byte, in, out []byte) {
+// aezTinyRoundsSlow applies the Feistel rounds of aezTiny to the halves L
+// and R, where each round enciphers (half & mask) ^ pad, with the round number
+// j in the last byte, with E(0,i).
+func (e *eState) aezTinyRoundsSlow(L, R, mask, pad *[blockSize]byte, i, j uint, step int, rounds uint) {
+	// NB: The hardware accelerated case is handled prior to this function.
+	var buf, tmp [blockSize]byte
+
+	for k := uint(0); k < rounds/2; k, j = k+1, uint(int(j)+2*step) {
+		for b := range buf {
+			buf[b] = R[b] & mask[b]
+		}
+		xorBytes1x16(buf[:], pad[:], buf[:])
+		buf[15] ^= byte(j)
+		e.aes4(&zero, &e.I[1], &e.L[i], buf[:], &tmp) // E(0,i)
+		xorBytes1x16(L[:], tmp[:], L[:])
+
+		for b := range buf {
+			buf[b] = L[b] & mask[b]
+		}
+		xorBytes1x16(buf[:], pad[:], buf[:])
+		buf[15] ^= byte(int(j) + step)
+		e.aes4(&zero, &e.I[1], &e.L[i], buf[:], &tmp) // E(0,i)
+		xorBytes1x16(R[:], tmp[:], R[:])
+	}
+
+	memwipe(buf[:])
+	memwipe(tmp[:])
+}
+
+func (e *eState) encipher(delta *[blockSize]byte, in, out []byte, workers int) {
 	if len(in) == 0 {
 		return
 	}
@@ -493,11 +657,11 @@ func (e *eState) encipher(delta *[blockSize]byte, in, out []byte) {
 	if len(in) < 32 {
 		e.aezTiny(delta, in, 0, out)
 	} else {
-		e.aezCore(delta, in, 0, out)
+		e.aezCore(delta, in, 0, out, workers)
 	}
 }
 
-func (e *eState) decipher(delta *[blockSize]byte, in, out []byte) {
+func (e *eState) decipher(delta *[blockSize]byte, in, out []byte, workers int) {
 	if len(in) == 0 {
 		return
 	}
@@ -505,92 +669,288 @@ func (e *eState) decipher(delta *[blockSize]byte, in, out []byte) {
 	if len(in) < 32 {
 		e.aezTiny(delta, in, 1, out)
 	} else {
-		e.aezCore(delta, in, 1, out)
+		e.aezCore(delta, in, 1, out, workers)
 	}
 }
 
-// Encrypt encrypts and authenticates the plaintext, authenticates the
-// additional data, and appends the result to ciphertext, returning the
-// updated slice.  The length of the authentication tag in bytes is specified
-// by tau.  The plaintext and dst slices MUST NOT overlap.
-func Encrypt(key []byte, nonce []byte, additionalData [][]byte, tau int, plaintext, dst []byte) []byte {
+func (e *eState) encrypt(nonce []byte, additionalData [][]byte, tau int, plaintext, dst []byte) []byte {
 	var delta [blockSize]byte
 
-	var x []byte
-	dstSz, xSz := len(dst), len(plaintext)+tau
-	if cap(dst) >= dstSz+xSz {
-		dst = dst[:dstSz+xSz]
-	} else {
-		x = make([]byte, dstSz+xSz)
-		copy(x, dst)
-		dst = x
-	}
-	x = dst[dstSz:]
+	e.aezHash(nonce, additionalData, tau*8, delta[:])
+	return e.encryptDelta(&delta, tau, plaintext, dst, 1)
+}
 
-	var e eState
-	defer e.reset()
+func (e *eState) encryptDelta(delta *[blockSize]byte, tau int, plaintext, dst []byte, workers int) []byte {
+	ret, x := sliceForAppend(dst, len(plaintext)+tau)
 
-	e.init(key)
-	e.aezHash(nonce, additionalData, tau*8, delta[:])
 	if len(plaintext) == 0 {
-		e.aezPRF(&delta, tau, x)
+		e.aezPRF(delta, tau, x)
 	} else {
-		memwipe(x[len(plaintext):])
+		// copy handles overlapping slices, and plaintext is not touched
+		// past this point, so x and plaintext may alias in any way.
 		copy(x, plaintext)
-		e.encipher(&delta, x, x)
+		memwipe(x[len(plaintext):])
+		e.encipher(delta, x, x, workers)
 	}
 
-	return dst
+	return ret
 }
 
-// Decrypt decrypts and authenticates the ciphertext, authenticates the
-// additional data, and if successful appends the resulting plaintext to the
-// provided slice and returns the updated slice and true.  The length of the
-// expected authentication tag in bytes is specified by tau.  The ciphertext
-// and dst slices MUST NOT overlap.
-func Decrypt(key []byte, nonce []byte, additionalData [][]byte, tau int, ciphertext, dst []byte) ([]byte, bool) {
+func (e *eState) decrypt(nonce []byte, additionalData [][]byte, tau int, ciphertext, dst []byte) ([]byte, bool) {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	e.aezHash(nonce, additionalData, tau*8, delta[:])
+	return e.decryptDelta(&delta, tau, ciphertext, dst, 1)
+}
+
+func (e *eState) decryptDelta(delta *[blockSize]byte, tau int, ciphertext, dst []byte, workers int) ([]byte, bool) {
+	ret, ok := e.decryptUnverifiedDelta(delta, tau, ciphertext, dst, workers)
+	if !ok {
+		// Wipe everything that was written, including the deciphered
+		// tag past the end of the returned slice.  Checking an AEZ-prf
+		// tag writes nothing to dst.
+		if len(ciphertext) > tau {
+			memwipe(ret[len(dst) : len(dst)+len(ciphertext)])
+		}
+		return nil, false
+	}
+	return ret, true
+}
+
+// aezPRFAt writes len(result) bytes of AEZ-prf output starting at byte
+// offset off.  off MUST be a multiple of a power of 2 that is at least
+// len(result), as is the case when the output is generated in fixed size
+// power of 2 chunks.
+func (e *eState) aezPRFAt(delta *[blockSize]byte, off int64, result []byte) {
+	var d [blockSize]byte
+
+	// The counter at off has no bits in common with the counters of the
+	// blocks within result, so XOR-ing it into delta is equivalent to
+	// starting AEZ-prf at that counter value.
+	copy(d[:], delta[:])
+	ctr := uint64(off / blockSize)
+	for i := 0; i < 8; i++ {
+		d[15-i] ^= byte(ctr >> uint(8*i))
+	}
+	e.aezPRF(&d, len(result), result)
+
+	memwipe(d[:])
+}
+
+func (e *eState) decryptUnverified(nonce []byte, additionalData [][]byte, tau int, ciphertext, dst []byte) ([]byte, bool) {
 	var delta [blockSize]byte
+
+	e.aezHash(nonce, additionalData, tau*8, delta[:])
+	return e.decryptUnverifiedDelta(&delta, tau, ciphertext, dst, 1)
+}
+
+func (e *eState) decryptUnverifiedDelta(delta *[blockSize]byte, tau int, ciphertext, dst []byte, workers int) ([]byte, bool) {
 	sum := byte(0)
 
 	if len(ciphertext) < tau {
 		return nil, false
 	}
 
-	var x []byte
-	dstSz, xSz := len(dst), len(ciphertext)
-	if cap(dst) >= dstSz+xSz {
-		dst = dst[:dstSz+xSz]
+	if len(ciphertext) == tau {
+		// Compare the tag against AEZ-prf a few blocks at a time, so that
+		// nothing is written to dst, which may alias the ciphertext, or
+		// need to grow.
+		var buf [4 * blockSize]byte
+		for off := 0; off < tau; off += len(buf) {
+			n := tau - off
+			if n > len(buf) {
+				n = len(buf)
+			}
+			e.aezPRFAt(delta, int64(off), buf[:n])
+			for i := 0; i < n; i++ {
+				sum |= buf[i] ^ ciphertext[off+i]
+			}
+		}
+		memwipe(buf[:])
+		return dst, sum == 0
+	}
+
+	ret, x := sliceForAppend(dst, len(ciphertext))
+	if inexactOverlap(x, ciphertext) {
+		copy(x, ciphertext)
+		ciphertext = x
+	}
+	e.decipher(delta, ciphertext, x, workers)
+	for i := 0; i < tau; i++ {
+		sum |= x[len(ciphertext)-tau+i]
+	}
+	return ret[:len(dst)+len(ciphertext)-tau], sum == 0
+}
+
+func (e *eState) tweakedCipher(tweak [][]byte, in, out []byte, d uint) {
+	var delta [blockSize]byte
+
+	if len(out) < len(in) {
+		panic("aez: output smaller than input")
+	}
+
+	// The first tweak element occupies the position of the nonce, so that
+	// enciphering is equivalent to encryption with tau = 0.
+	var nonce []byte
+	var ad [][]byte
+	if len(tweak) > 0 {
+		nonce, ad = tweak[0], tweak[1:]
+	}
+
+	e.aezHash(nonce, ad, 0, delta[:])
+	if d == 0 {
+		e.encipher(&delta, in, out[:len(in)], 1)
 	} else {
-		x = make([]byte, dstSz+xSz)
-		copy(x, dst)
-		dst = x
+		e.decipher(&delta, in, out[:len(in)], 1)
 	}
-	x = dst[dstSz:]
 
+	memwipe(delta[:])
+}
+
+// Encrypt encrypts and authenticates the plaintext, authenticates the
+// additional data, and appends the result to ciphertext, returning the
+// updated slice.  The length of the authentication tag in bytes is specified
+// by tau.  The plaintext and dst slices may overlap, and plaintext[:0] may be
+// used as dst to encrypt in place.
+func Encrypt(key []byte, nonce []byte, additionalData [][]byte, tau int, plaintext, dst []byte) []byte {
 	var e eState
 	defer e.reset()
 
 	e.init(key)
-	e.aezHash(nonce, additionalData, tau*8, delta[:])
-	if len(ciphertext) == tau {
-		e.aezPRF(&delta, tau, x)
-		for i := 0; i < tau; i++ {
-			sum |= x[i] ^ ciphertext[i]
-		}
-		dst = dst[:dstSz]
-	} else {
-		e.decipher(&delta, ciphertext, x)
-		for i := 0; i < tau; i++ {
-			sum |= x[len(ciphertext)-tau+i]
-		}
-		if sum == 0 {
-			dst = dst[:dstSz+len(ciphertext)-tau]
-		}
-	}
-	if sum != 0 { // return true if valid, false if invalid
-		return nil, false
+	return e.encrypt(nonce, additionalData, tau, plaintext, dst)
+}
+
+// Decrypt decrypts and authenticates the ciphertext, authenticates the
+// additional data, and if successful appends the resulting plaintext to the
+// provided slice and returns the updated slice and true.  The length of the
+// expected authentication tag in bytes is specified by tau.  The ciphertext
+// and dst slices may overlap, and ciphertext[:0] may be used as dst to
+// decrypt in place.  If authentication fails, the bytes of dst past its
+// length that were written to are zeroed.
+func Decrypt(key []byte, nonce []byte, additionalData [][]byte, tau int, ciphertext, dst []byte) ([]byte, bool) {
+	var e eState
+	defer e.reset()
+
+	e.init(key)
+	return e.decrypt(nonce, additionalData, tau, ciphertext, dst)
+}
+
+// DecryptUnverified decrypts the ciphertext, and appends the resulting
+// plaintext to the provided slice, returning the updated slice and true iff
+// the ciphertext and additional data are authentic.  Unlike Decrypt, the
+// plaintext is returned even when authentication fails, as AEZ is secure
+// under the release of unverified plaintext.  Such plaintext MUST be treated
+// as untrusted.  If the ciphertext is shorter than tau, nil and false are
+// returned.  The ciphertext and dst slices may overlap, and ciphertext[:0]
+// may be used as dst to decrypt in place.
+func DecryptUnverified(key []byte, nonce []byte, additionalData [][]byte, tau int, ciphertext, dst []byte) ([]byte, bool) {
+	var e eState
+	defer e.reset()
+
+	e.init(key)
+	return e.decryptUnverified(nonce, additionalData, tau, ciphertext, dst)
+}
+
+// Encipher enciphers in with the AEZ arbitrary-input-length tweakable
+// block cipher, under the provided vector tweak, and writes the len(in) byte
+// result to out.  Enciphering is length preserving and provides no
+// authentication, and is equivalent to Encrypt with tweak[0] as the nonce,
+// tweak[1:] as the additional data, and a tau of 0.  The in and out slices
+// may be identical, but MUST NOT otherwise overlap.
+func Encipher(key []byte, tweak [][]byte, in, out []byte) {
+	var e eState
+	defer e.reset()
+
+	e.init(key)
+	e.tweakedCipher(tweak, in, out, 0)
+}
+
+// Decipher deciphers in with the AEZ arbitrary-input-length tweakable
+// block cipher, under the provided vector tweak, and writes the len(in) byte
+// result to out.  The in and out slices may be identical, but MUST NOT
+// otherwise overlap.
+func Decipher(key []byte, tweak [][]byte, in, out []byte) {
+	var e eState
+	defer e.reset()
+
+	e.init(key)
+	e.tweakedCipher(tweak, in, out, 1)
+}
+
+// Cipher is an AEZ instance keyed with a specific key.  The key schedule is
+// derived once at construction time, which avoids the per-call setup cost
+// incurred by the one-shot Encrypt and Decrypt calls.  A Cipher is safe for
+// concurrent use by multiple goroutines.
+type Cipher struct {
+	e eState
+}
+
+// Encrypt encrypts and authenticates the plaintext, authenticates the
+// additional data, and appends the result to ciphertext, returning the
+// updated slice.  The length of the authentication tag in bytes is specified
+// by tau.  The plaintext and dst slices may overlap, and plaintext[:0] may be
+// used as dst to encrypt in place.
+func (c *Cipher) Encrypt(nonce []byte, additionalData [][]byte, tau int, plaintext, dst []byte) []byte {
+	return c.e.encrypt(nonce, additionalData, tau, plaintext, dst)
+}
+
+// Decrypt decrypts and authenticates the ciphertext, authenticates the
+// additional data, and if successful appends the resulting plaintext to the
+// provided slice and returns the updated slice and true.  The length of the
+// expected authentication tag in bytes is specified by tau.  The ciphertext
+// and dst slices may overlap, and ciphertext[:0] may be used as dst to
+// decrypt in place.  If authentication fails, the bytes of dst past its
+// length that were written to are zeroed.
+func (c *Cipher) Decrypt(nonce []byte, additionalData [][]byte, tau int, ciphertext, dst []byte) ([]byte, bool) {
+	return c.e.decrypt(nonce, additionalData, tau, ciphertext, dst)
+}
+
+// DecryptUnverified decrypts the ciphertext, and appends the resulting
+// plaintext to the provided slice, returning the updated slice and true iff
+// the ciphertext and additional data are authentic.  Unlike Decrypt, the
+// plaintext is returned even when authentication fails, as AEZ is secure
+// under the release of unverified plaintext.  Such plaintext MUST be treated
+// as untrusted.  If the ciphertext is shorter than tau, nil and false are
+// returned.  The ciphertext and dst slices may overlap, and ciphertext[:0]
+// may be used as dst to decrypt in place.
+func (c *Cipher) DecryptUnverified(nonce []byte, additionalData [][]byte, tau int, ciphertext, dst []byte) ([]byte, bool) {
+	return c.e.decryptUnverified(nonce, additionalData, tau, ciphertext, dst)
+}
+
+// Encipher enciphers in with the AEZ arbitrary-input-length tweakable
+// block cipher, under the provided vector tweak, and writes the len(in) byte
+// result to out.  Enciphering is length preserving and provides no
+// authentication, and is equivalent to Encrypt with tweak[0] as the nonce,
+// tweak[1:] as the additional data, and a tau of 0.  The in and out slices
+// may be identical, but MUST NOT otherwise overlap.
+func (c *Cipher) Encipher(tweak [][]byte, in, out []byte) {
+	c.e.tweakedCipher(tweak, in, out, 0)
+}
+
+// Decipher deciphers in with the AEZ arbitrary-input-length tweakable
+// block cipher, under the provided vector tweak, and writes the len(in) byte
+// result to out.  The in and out slices may be identical, but MUST NOT
+// otherwise overlap.
+func (c *Cipher) Decipher(tweak [][]byte, in, out []byte) {
+	c.e.tweakedCipher(tweak, in, out, 1)
+}
+
+// Reset clears the sensitive keying material from the datastructure such
+// that it will no longer be in memory.  The Cipher MUST NOT be used after
+// it has been reset.
+func (c *Cipher) Reset() {
+	c.e.reset()
+}
+
+// NewCipher returns a new Cipher instance keyed with the provided key.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) == 0 {
+		return nil, errInvalidKeySize
 	}
-	return dst, true
+	c := new(Cipher)
+	c.e.init(key)
+	return c, nil
 }
 
 // IsHardwareAccelerated returns true iff the AEZ implementation will use
@@ -599,6 +959,31 @@ func IsHardwareAccelerated() bool {
 	return isHardwareAccelerated
 }
 
+// sliceForAppend extends in by n bytes, reallocating only if the capacity is
+// insufficient, and returns the extended slice along with the n byte tail.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// inexactOverlap returns true iff x and y share memory at any
+// non-corresponding index.
+func inexactOverlap(x, y []byte) bool {
+	if len(x) == 0 || len(y) == 0 || &x[0] == &y[0] {
+		return false
+	}
+
+	xp := reflect.ValueOf(&x[0]).Pointer()
+	yp := reflect.ValueOf(&y[0]).Pointer()
+	return xp < yp+uintptr(len(y)) && yp < xp+uintptr(len(x))
+}
+
 func memwipe(b []byte) {
 	for i := range b {
 		b[i] = 0
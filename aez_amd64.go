@@ -9,6 +9,8 @@
 
 package aez
 
+import "encoding/binary"
+
 var useAESNI = false
 
 //go:noescape
@@ -29,6 +31,21 @@ func aezAES4AMD64AESNI(j, i, l, k, src, dst *byte)
 //go:noescape
 func aezAES10AMD64AESNI(l, k, src, dst *byte)
 
+//go:noescape
+func aezHashBlocksAMD64AESNI(src, sum, j, i, l, k, consts *byte, sz int)
+
+//go:noescape
+func aezPRFAMD64AESNI(delta, l, k, dst *byte, blocks int)
+
+//go:noescape
+func aezTinyRoundsAMD64AESNI(left, right, mask, pad, i, l, k *byte, j, step, rounds int)
+
+//go:noescape
+func aezAES4BlocksAMD64AESNI(k, buf *byte, blocks int)
+
+//go:noescape
+func aezAES10BlocksAMD64AESNI(k, buf *byte, blocks int)
+
 //go:noescape
 func aezCorePass1AMD64AESNI(src, dst, x, i, l, k, consts *byte, sz int)
 
@@ -67,6 +84,30 @@ func newRoundAESNI(extractedKey *[extractedKeySize]byte) aesImpl {
 	return r
 }
 
+func (e *eState) aes4(j, i, l *[blockSize]byte, src []byte, dst *[blockSize]byte) {
+	// Call the "slow" implementation if hardware/OS doesn't allow AES-NI.
+	a, ok := e.aes.(*roundAESNI)
+	if !ok {
+		e.aes4Slow(j, i, l, src, dst)
+		return
+	}
+
+	// Call the AES-NI implementation.
+	aezAES4AMD64AESNI(&j[0], &i[0], &l[0], &a.keys[0], &src[0], &dst[0])
+}
+
+func (e *eState) aes10(l *[blockSize]byte, src []byte, dst *[blockSize]byte) {
+	// Call the "slow" implementation if hardware/OS doesn't allow AES-NI.
+	a, ok := e.aes.(*roundAESNI)
+	if !ok {
+		e.aes10Slow(l, src, dst)
+		return
+	}
+
+	// Call the AES-NI implementation.
+	aezAES10AMD64AESNI(&l[0], &a.keys[0], &src[0], &dst[0])
+}
+
 var dblConsts = [32]byte{
 	// PSHUFB constant
 	0x0f, 0x0e, 0x0d, 0x0c, 0x0b, 0x0a, 0x09, 0x08,
@@ -77,28 +118,120 @@ var dblConsts = [32]byte{
 	0x01, 0x00, 0x00, 0x00, 0x87, 0x00, 0x00, 0x00,
 }
 
-func (e *eState) aezCorePass1(in, out []byte, X *[blockSize]byte, sz int) {
+func (e *eState) aezHashBlocks(J *[blockSize]byte, in []byte, sum *[blockSize]byte) {
+	// Call the "slow" implementation if hardware/OS doesn't allow AES-NI.
+	if !useAESNI {
+		e.aezHashBlocksSlow(J, in, sum)
+		return
+	}
+	if len(in) < blockSize {
+		return
+	}
+
+	// Call the AES-NI implementation.
+	a := e.aes.(*roundAESNI)
+	aezHashBlocksAMD64AESNI(&in[0], &sum[0], &J[0], &e.I[1][0], &e.L[0][0], &a.keys[0], &dblConsts[0], len(in))
+}
+
+func (e *eState) aezPRF(delta *[blockSize]byte, tau int, result []byte) {
+	// Call the "slow" implementation if hardware/OS doesn't allow AES-NI.
+	if !useAESNI {
+		e.aezPRFSlow(delta, tau, result)
+		return
+	}
+
+	// Call the AES-NI implementation for the full blocks.
+	a := e.aes.(*roundAESNI)
+	blocks := tau / blockSize
+	if blocks > 0 {
+		aezPRFAMD64AESNI(&delta[0], &e.L[3][0], &a.keys[0], &result[0], blocks)
+	}
+
+	// Handle the final partial block.
+	if off := blocks * blockSize; off < tau {
+		var buf [blockSize]byte
+		binary.BigEndian.PutUint64(buf[8:], uint64(blocks))
+		xorBytes1x16(delta[:], buf[:], buf[:])
+		a.AES10(&e.L[3], buf[:], &buf) // E(-1,3)
+		copy(result[off:tau], buf[:])
+		memwipe(buf[:])
+	}
+}
+
+func (e *eState) aezTinyRounds(L, R, mask, pad *[blockSize]byte, i, j uint, step int, rounds uint) {
+	// Call the "slow" implementation if hardware/OS doesn't allow AES-NI.
+	if !useAESNI {
+		e.aezTinyRoundsSlow(L, R, mask, pad, i, j, step, rounds)
+		return
+	}
+
+	// Call the AES-NI implementation.
+	a := e.aes.(*roundAESNI)
+	aezTinyRoundsAMD64AESNI(&L[0], &R[0], &mask[0], &pad[0], &e.I[1][0], &e.L[i][0], &a.keys[0], int(j), step, int(rounds))
+}
+
+func (e *eState) aes4Blocks(buf []byte) {
+	// Call the "slow" implementation if hardware/OS doesn't allow AES-NI.
+	if !useAESNI {
+		e.aes4BlocksSlow(buf)
+		return
+	}
+	if len(buf) < blockSize {
+		return
+	}
+
+	// Call the AES-NI implementation.
+	a := e.aes.(*roundAESNI)
+	aezAES4BlocksAMD64AESNI(&a.keys[0], &buf[0], len(buf)/blockSize)
+}
+
+func (e *eState) aes10Blocks(buf []byte) {
+	// Call the "slow" implementation if hardware/OS doesn't allow AES-NI.
+	if !useAESNI {
+		e.aes10BlocksSlow(buf)
+		return
+	}
+	if len(buf) < blockSize {
+		return
+	}
+
+	// Call the AES-NI implementation.
+	a := e.aes.(*roundAESNI)
+	aezAES10BlocksAMD64AESNI(&a.keys[0], &buf[0], len(buf)/blockSize)
+}
+
+func (e *eState) batchCoreSize() int {
+	// The AES-NI AEZ-core passes interleave the blocks of each message
+	// faster than the blocks of several messages can be queued, so only
+	// batch AEZ-core for the bitsliced implementations.
+	if useAESNI {
+		return 0
+	}
+	return maxBatchCoreSize
+}
+
+func (e *eState) aezCorePass1(in, out []byte, X, I *[blockSize]byte, sz int) {
 	// Call the "slow" implementation if hardware/OS doesn't allow AES-NI.
 	if !useAESNI {
-		e.aezCorePass1Slow(in, out, X, sz)
+		e.aezCorePass1Slow(in, out, X, I, sz)
 		return
 	}
 
 	// Call the AES-NI implementation.
 	a := e.aes.(*roundAESNI)
-	aezCorePass1AMD64AESNI(&in[0], &out[0], &X[0], &e.I[1][0], &e.L[0][0], &a.keys[0], &dblConsts[0], sz)
+	aezCorePass1AMD64AESNI(&in[0], &out[0], &X[0], &I[0], &e.L[0][0], &a.keys[0], &dblConsts[0], sz)
 }
 
-func (e *eState) aezCorePass2(in, out []byte, Y, S *[blockSize]byte, sz int) {
+func (e *eState) aezCorePass2(in, out []byte, Y, S, I *[blockSize]byte, sz int) {
 	// Call the "slow" implementation if hardware/OS doesn't allow AES-NI.
 	if !useAESNI {
-		e.aezCorePass2Slow(in, out, Y, S, sz)
+		e.aezCorePass2Slow(in, out, Y, S, I, sz)
 		return
 	}
 
 	// Call the AES-NI implementation.
 	a := e.aes.(*roundAESNI)
-	aezCorePass2AMD64AESNI(&out[0], &Y[0], &S[0], &e.J[0][0], &e.I[1][0], &e.L[0][0], &a.keys[0], &dblConsts[0], sz)
+	aezCorePass2AMD64AESNI(&out[0], &Y[0], &S[0], &e.J[0][0], &I[0], &e.L[0][0], &a.keys[0], &dblConsts[0], sz)
 }
 
 func supportsAESNI() bool {
@@ -213,18 +213,18 @@ with Function("aezAES4AMD64AESNI", (j, i, l, k, src, dst), target=uarch.zen):
     xmm_zero = XMMRegister()
 
     MOVDQU(xmm_state, [reg_src])
-    MOVDQA(xmm_j, [reg_j])
-    MOVDQA(xmm_i, [reg_i])
-    MOVDQA(xmm_l, [reg_l])
+    MOVDQU(xmm_j, [reg_j])
+    MOVDQU(xmm_i, [reg_i])
+    MOVDQU(xmm_l, [reg_l])
 
     PXOR(xmm_state, xmm_j)
     PXOR(xmm_i, xmm_l)
     PXOR(xmm_state, xmm_i)
     PXOR(xmm_zero, xmm_zero)
 
-    MOVDQA(xmm_i, [reg_k])
-    MOVDQA(xmm_j, [reg_k+16])
-    MOVDQA(xmm_l, [reg_k+32])
+    MOVDQU(xmm_i, [reg_k])
+    MOVDQU(xmm_j, [reg_k+16])
+    MOVDQU(xmm_l, [reg_k+32])
 
     aesenc4x1(xmm_state, xmm_j, xmm_i, xmm_l, xmm_zero)
 
@@ -248,9 +248,9 @@ with Function("aezAES10AMD64AESNI", (l, k, src, dst), target=uarch.zen):
 
     PXOR(xmm_state, xmm_l)
 
-    MOVDQA(xmm_i, [reg_k])
-    MOVDQA(xmm_j, [reg_k+16])
-    MOVDQA(xmm_l, [reg_k+32])
+    MOVDQU(xmm_i, [reg_k])
+    MOVDQU(xmm_j, [reg_k+16])
+    MOVDQU(xmm_l, [reg_k+32])
 
     AESENC(xmm_state, xmm_i)
     AESENC(xmm_state, xmm_j)
@@ -282,6 +282,521 @@ x = Argument(ptr(uint8_t))
 consts = Argument(ptr(const_uint8_t))
 sz = Argument(ptr(size_t))
 
+sum_ = Argument(ptr(uint8_t), name="sum")
+
+with Function("aezHashBlocksAMD64AESNI", (src, sum_, j, i, l, k, consts, sz), target=uarch.zen):
+    reg_src = GeneralPurposeRegister64()
+    reg_sum = GeneralPurposeRegister64()
+    reg_tmp = registers.rcx # Not BP, which Go reserves for the frame pointer.
+    reg_l = GeneralPurposeRegister64()
+    reg_bytes = GeneralPurposeRegister64()
+    reg_idx = GeneralPurposeRegister64()
+
+    LOAD.ARGUMENT(reg_src, src)  # src pointer
+    LOAD.ARGUMENT(reg_sum, sum_)
+    LOAD.ARGUMENT(reg_l, l)      # e.L[]
+    LOAD.ARGUMENT(reg_bytes, sz) # bytes remaining
+    MOV(reg_idx, 1)              # Index into e.L[]
+
+    xmm_j = XMMRegister()     # AESENC Round key J
+    xmm_i = XMMRegister()     # AESENC Round key I
+    xmm_l = XMMRegister()     # AESENC Round Key L
+    xmm_sum = XMMRegister()   # Hash sum
+    xmm_iDbl = XMMRegister()  # e.I[1]
+    xmm_tweak = XMMRegister() # Tweak J
+    xmm_tmp0 = XMMRegister()
+    xmm_zero = XMMRegister()  # [16]byte{0x00}
+
+    xmm_o0 = XMMRegister()
+    xmm_o1 = XMMRegister()
+    xmm_o2 = XMMRegister()
+    xmm_o3 = XMMRegister()
+    xmm_o4 = XMMRegister()
+    xmm_o5 = XMMRegister()
+    xmm_o6 = XMMRegister()
+    xmm_o7 = XMMRegister()
+
+    MOVDQU(xmm_sum, [reg_sum])
+
+    LOAD.ARGUMENT(reg_tmp, j)
+    MOVDQU(xmm_tweak, [reg_tmp])
+
+    LOAD.ARGUMENT(reg_tmp, i)
+    MOVDQU(xmm_iDbl, [reg_tmp])
+
+    LOAD.ARGUMENT(reg_tmp, k)
+    MOVDQU(xmm_i, [reg_tmp])
+    MOVDQU(xmm_j, [reg_tmp+16])
+    MOVDQU(xmm_l, [reg_tmp+32])
+
+    LOAD.ARGUMENT(reg_tmp, consts) # doubleBlock constants
+
+    PXOR(xmm_zero, xmm_zero)
+
+    # Process 8 * 16 bytes at a time in a loop.
+    vector_loop128 = Loop()
+    SUB(reg_bytes, 128)
+    JB(vector_loop128.end)
+    with vector_loop128:
+        # o0 = aes4(o0 ^ J ^ I ^ L[1], keys) // E(J,1)
+        # o1 = aes4(o1 ^ J ^ I ^ L[2], keys) // E(J,2)
+        # o2 = aes4(o2 ^ J ^ I ^ L[3], keys) // E(J,3)
+        # o3 = aes4(o3 ^ J ^ I ^ L[4], keys) // E(J,4)
+        # o4 = aes4(o4 ^ J ^ I ^ L[5], keys) // E(J,5)
+        # o5 = aes4(o5 ^ J ^ I ^ L[6], keys) // E(J,6)
+        # o6 = aes4(o6 ^ J ^ I ^ L[7], keys) // E(J,7)
+        # o7 = aes4(o7 ^ J ^ I ^ L[0], keys) // E(J,8)
+        MOVDQU(xmm_o0, [reg_src])
+        MOVDQU(xmm_o1, [reg_src+16])
+        MOVDQU(xmm_o2, [reg_src+32])
+        MOVDQU(xmm_o3, [reg_src+48])
+        MOVDQU(xmm_o4, [reg_src+64])
+        MOVDQU(xmm_o5, [reg_src+80])
+        MOVDQU(xmm_o6, [reg_src+96])
+        MOVDQU(xmm_o7, [reg_src+112])
+        MOVDQA(xmm_tmp0, xmm_tweak) # tmp = tweak ^ iDbl
+        PXOR(xmm_tmp0, xmm_iDbl)
+        PXOR(xmm_o0, xmm_tmp0)
+        PXOR(xmm_o1, xmm_tmp0)
+        PXOR(xmm_o2, xmm_tmp0)
+        PXOR(xmm_o3, xmm_tmp0)
+        PXOR(xmm_o4, xmm_tmp0)
+        PXOR(xmm_o5, xmm_tmp0)
+        PXOR(xmm_o6, xmm_tmp0)
+        PXOR(xmm_o7, xmm_tmp0)
+        MOVDQU(xmm_tmp0, [reg_l+16])
+        PXOR(xmm_o0, xmm_tmp0)  # L[1]
+        MOVDQU(xmm_tmp0, [reg_l+32])
+        PXOR(xmm_o1, xmm_tmp0)  # L[2]
+        MOVDQU(xmm_tmp0, [reg_l+48])
+        PXOR(xmm_o2, xmm_tmp0)  # L[3]
+        MOVDQU(xmm_tmp0, [reg_l+64])
+        PXOR(xmm_o3, xmm_tmp0)  # L[4]
+        MOVDQU(xmm_tmp0, [reg_l+80])
+        PXOR(xmm_o4, xmm_tmp0)  # L[5]
+        MOVDQU(xmm_tmp0, [reg_l+96])
+        PXOR(xmm_o5, xmm_tmp0)  # L[6]
+        MOVDQU(xmm_tmp0, [reg_l+112])
+        PXOR(xmm_o6, xmm_tmp0) # L[7]
+        MOVDQU(xmm_tmp0, [reg_l])
+        PXOR(xmm_o7, xmm_tmp0)     # L[0]
+        aesenc4x8(xmm_o0, xmm_o1, xmm_o2, xmm_o3, xmm_o4, xmm_o5, xmm_o6, xmm_o7, xmm_j, xmm_i, xmm_l, xmm_zero)
+
+        # sum ^= o0 ^ o1 ^ o2 ^ o3 ^ o4 ^ o5 ^ o6 ^ o7
+        PXOR(xmm_sum, xmm_o0)
+        PXOR(xmm_sum, xmm_o1)
+        PXOR(xmm_sum, xmm_o2)
+        PXOR(xmm_sum, xmm_o3)
+        PXOR(xmm_sum, xmm_o4)
+        PXOR(xmm_sum, xmm_o5)
+        PXOR(xmm_sum, xmm_o6)
+        PXOR(xmm_sum, xmm_o7)
+
+        # doubleBlock(I)
+        doubleBlock(xmm_iDbl, xmm_tmp0, xmm_o0, reg_tmp)
+
+        # Update book keeping.
+        ADD(reg_src, 128)
+        SUB(reg_bytes, 128)
+        JAE(vector_loop128.begin)
+    ADD(reg_bytes, 128)
+    process_16bytes = Label()
+    SUB(reg_bytes, 64)
+    JB(process_16bytes)
+
+    #
+    # Process 4 * 16 bytes.
+    #
+
+    # o0 = aes4(o0 ^ J ^ I ^ L[1], keys) // E(J,1)
+    # o1 = aes4(o1 ^ J ^ I ^ L[2], keys) // E(J,2)
+    # o2 = aes4(o2 ^ J ^ I ^ L[3], keys) // E(J,3)
+    # o3 = aes4(o3 ^ J ^ I ^ L[4], keys) // E(J,4)
+    MOVDQU(xmm_o0, [reg_src])
+    MOVDQU(xmm_o1, [reg_src+16])
+    MOVDQU(xmm_o2, [reg_src+32])
+    MOVDQU(xmm_o3, [reg_src+48])
+    MOVDQA(xmm_tmp0, xmm_tweak) # tmp = tweak ^ iDbl
+    PXOR(xmm_tmp0, xmm_iDbl)
+    PXOR(xmm_o0, xmm_tmp0)
+    PXOR(xmm_o1, xmm_tmp0)
+    PXOR(xmm_o2, xmm_tmp0)
+    PXOR(xmm_o3, xmm_tmp0)
+    MOVDQU(xmm_tmp0, [reg_l+16])
+    PXOR(xmm_o0, xmm_tmp0) # L[1]
+    MOVDQU(xmm_tmp0, [reg_l+32])
+    PXOR(xmm_o1, xmm_tmp0) # L[2]
+    MOVDQU(xmm_tmp0, [reg_l+48])
+    PXOR(xmm_o2, xmm_tmp0) # L[3]
+    MOVDQU(xmm_tmp0, [reg_l+64])
+    PXOR(xmm_o3, xmm_tmp0) # L[4]
+    aesenc4x4(xmm_o0, xmm_o1, xmm_o2, xmm_o3, xmm_j, xmm_i, xmm_l, xmm_zero)
+
+    # sum ^= o0 ^ o1 ^ o2 ^ o3
+    PXOR(xmm_sum, xmm_o0)
+    PXOR(xmm_sum, xmm_o1)
+    PXOR(xmm_sum, xmm_o2)
+    PXOR(xmm_sum, xmm_o3)
+
+    # Update book keeping.
+    ADD(reg_src, 64)
+    ADD(reg_idx, 4)
+    SUB(reg_bytes, 64)
+
+    LABEL(process_16bytes)
+    ADD(reg_bytes, 64)
+
+    #
+    # Process 1 * 16 bytes at a time in a loop.
+    #
+
+    # At most 7 blocks remain, so the index never wraps.
+    MOVDQA(xmm_tmp0, xmm_tweak) # tmp = tweak ^ iDbl
+    PXOR(xmm_tmp0, xmm_iDbl)
+    SHL(reg_idx, 4)
+    ADD(reg_l, reg_idx)         # reg_l += reg_idx (&L[i])
+
+    out = Label()
+    SUB(reg_bytes, 16)
+    JB(out)
+    process_16bytes_loop = Loop()
+    with process_16bytes_loop:
+        # o0 = aes4(o0 ^ J ^ I ^ L[i], keys) // E(J,i)
+        MOVDQU(xmm_o0, [reg_src])
+        PXOR(xmm_o0, xmm_tmp0)
+        MOVDQU(xmm_o1, [reg_l])
+        PXOR(xmm_o0, xmm_o1)
+        aesenc4x1(xmm_o0, xmm_j, xmm_i, xmm_l, xmm_zero)
+
+        # sum ^= o0
+        PXOR(xmm_sum, xmm_o0)
+
+        # Update book keeping.
+        ADD(reg_src, 16)
+        ADD(reg_l, 16)
+        SUB(reg_bytes, 16)
+        JAE(process_16bytes_loop.begin)
+
+    LABEL(out)
+
+    # Write back sum.
+    MOVDQU([reg_sum], xmm_sum)
+
+    RETURN()
+
+delta = Argument(ptr(const_uint8_t))
+blocks = Argument(size_t)
+
+def ctrBlock(blk, reg_ctr, reg_tmp, xmm_delta):
+    # blk = delta ^ L[3] ^ uint128_be(ctr), ctr++
+    MOV(reg_tmp, reg_ctr)
+    BSWAP(reg_tmp)
+    MOVQ(blk, reg_tmp)
+    PSLLDQ(blk, 8)
+    PXOR(blk, xmm_delta)
+    INC(reg_ctr)
+
+def aesenc10x4(o0, o1, o2, o3, i, j, l):
+    for key in [i, j, l, i, j, l, i, j, l, i]:
+        AESENC(o0, key)
+        AESENC(o1, key)
+        AESENC(o2, key)
+        AESENC(o3, key)
+
+with Function("aezPRFAMD64AESNI", (delta, l, k, dst, blocks), target=uarch.zen):
+    reg_delta = GeneralPurposeRegister64()
+    reg_l = GeneralPurposeRegister64()
+    reg_k = GeneralPurposeRegister64()
+    reg_dst = GeneralPurposeRegister64()
+    reg_blocks = GeneralPurposeRegister64()
+    reg_ctr = GeneralPurposeRegister64()
+    reg_tmp = GeneralPurposeRegister64()
+
+    LOAD.ARGUMENT(reg_delta, delta)
+    LOAD.ARGUMENT(reg_l, l)           # e.L[3]
+    LOAD.ARGUMENT(reg_k, k)
+    LOAD.ARGUMENT(reg_dst, dst)       # dst pointer
+    LOAD.ARGUMENT(reg_blocks, blocks) # blocks remaining
+    XOR(reg_ctr, reg_ctr)             # Counter
+
+    xmm_delta = XMMRegister() # delta ^ L[3]
+    xmm_tmp0 = XMMRegister()
+    xmm_i = XMMRegister()     # AESENC Round key I
+    xmm_j = XMMRegister()     # AESENC Round key J
+    xmm_l = XMMRegister()     # AESENC Round Key L
+
+    xmm_o0 = XMMRegister()
+    xmm_o1 = XMMRegister()
+    xmm_o2 = XMMRegister()
+    xmm_o3 = XMMRegister()
+
+    MOVDQU(xmm_delta, [reg_delta])
+    MOVDQU(xmm_tmp0, [reg_l])
+    PXOR(xmm_delta, xmm_tmp0)
+
+    MOVDQU(xmm_i, [reg_k])
+    MOVDQU(xmm_j, [reg_k+16])
+    MOVDQU(xmm_l, [reg_k+32])
+
+    # Process 4 counter blocks at a time in a loop.
+    vector_loop4 = Loop()
+    SUB(reg_blocks, 4)
+    JB(vector_loop4.end)
+    with vector_loop4:
+        # o0 = aes10(delta ^ L[3] ^ (ctr+0), keys) // E(-1,3)
+        # o1 = aes10(delta ^ L[3] ^ (ctr+1), keys) // E(-1,3)
+        # o2 = aes10(delta ^ L[3] ^ (ctr+2), keys) // E(-1,3)
+        # o3 = aes10(delta ^ L[3] ^ (ctr+3), keys) // E(-1,3)
+        ctrBlock(xmm_o0, reg_ctr, reg_tmp, xmm_delta)
+        ctrBlock(xmm_o1, reg_ctr, reg_tmp, xmm_delta)
+        ctrBlock(xmm_o2, reg_ctr, reg_tmp, xmm_delta)
+        ctrBlock(xmm_o3, reg_ctr, reg_tmp, xmm_delta)
+        aesenc10x4(xmm_o0, xmm_o1, xmm_o2, xmm_o3, xmm_i, xmm_j, xmm_l)
+
+        MOVDQU([reg_dst], xmm_o0)
+        MOVDQU([reg_dst+16], xmm_o1)
+        MOVDQU([reg_dst+32], xmm_o2)
+        MOVDQU([reg_dst+48], xmm_o3)
+
+        # Update book keeping.
+        ADD(reg_dst, 64)
+        SUB(reg_blocks, 4)
+        JAE(vector_loop4.begin)
+    ADD(reg_blocks, 4)
+
+    # Process 1 counter block at a time in a loop.
+    out = Label()
+    SUB(reg_blocks, 1)
+    JB(out)
+    process_16bytes_loop = Loop()
+    with process_16bytes_loop:
+        # o0 = aes10(delta ^ L[3] ^ ctr, keys) // E(-1,3)
+        ctrBlock(xmm_o0, reg_ctr, reg_tmp, xmm_delta)
+        for key in [xmm_i, xmm_j, xmm_l, xmm_i, xmm_j, xmm_l, xmm_i, xmm_j, xmm_l, xmm_i]:
+            AESENC(xmm_o0, key)
+
+        MOVDQU([reg_dst], xmm_o0)
+
+        # Update book keeping.
+        ADD(reg_dst, 16)
+        SUB(reg_blocks, 1)
+        JAE(process_16bytes_loop.begin)
+
+    LABEL(out)
+
+    RETURN()
+
+left = Argument(ptr(uint8_t))
+right = Argument(ptr(uint8_t))
+mask = Argument(ptr(const_uint8_t))
+pad = Argument(ptr(const_uint8_t))
+tiny_j = Argument(ptrdiff_t, name="j")
+step = Argument(ptrdiff_t)
+rounds = Argument(size_t)
+
+def tinyRound(o, src, dst, xmm_mask, xmm_pad, reg_j, reg_step, reg_tmp, xmm_tmp, j, i, l, z):
+    # dst ^= aes4((src & mask) ^ pad ^ I ^ L[i] ^ (j << 120), keys) // E(0,i)
+    # j += step
+    MOVDQA(o, src)
+    PAND(o, xmm_mask)
+    PXOR(o, xmm_pad)
+    MOV(reg_tmp, reg_j)
+    SHL(reg_tmp, 56)
+    MOVQ(xmm_tmp, reg_tmp)
+    PSLLDQ(xmm_tmp, 8)
+    PXOR(o, xmm_tmp)
+    aesenc4x1(o, j, i, l, z)
+    PXOR(dst, o)
+    ADD(reg_j, reg_step)
+
+with Function("aezTinyRoundsAMD64AESNI", (left, right, mask, pad, i, l, k, tiny_j, step, rounds), target=uarch.zen):
+    reg_left = GeneralPurposeRegister64()
+    reg_right = GeneralPurposeRegister64()
+    reg_tmp = GeneralPurposeRegister64()
+    reg_j = GeneralPurposeRegister64()
+    reg_step = GeneralPurposeRegister64()
+    reg_rounds = GeneralPurposeRegister64()
+
+    LOAD.ARGUMENT(reg_left, left)
+    LOAD.ARGUMENT(reg_right, right)
+
+    xmm_left = XMMRegister()
+    xmm_right = XMMRegister()
+    xmm_j = XMMRegister()    # AESENC Round key J
+    xmm_i = XMMRegister()    # AESENC Round key I
+    xmm_l = XMMRegister()    # AESENC Round Key L
+    xmm_zero = XMMRegister() # [16]byte{0x00}
+    xmm_mask = XMMRegister()
+    xmm_pad = XMMRegister()  # pad ^ e.I[1] ^ e.L[i]
+    xmm_o0 = XMMRegister()
+    xmm_tmp0 = XMMRegister()
+
+    MOVDQU(xmm_left, [reg_left])
+    MOVDQU(xmm_right, [reg_right])
+
+    LOAD.ARGUMENT(reg_tmp, mask)
+    MOVDQU(xmm_mask, [reg_tmp])
+    LOAD.ARGUMENT(reg_tmp, pad)
+    MOVDQU(xmm_pad, [reg_tmp])
+    LOAD.ARGUMENT(reg_tmp, i)
+    MOVDQU(xmm_o0, [reg_tmp])
+    PXOR(xmm_pad, xmm_o0)
+    LOAD.ARGUMENT(reg_tmp, l)
+    MOVDQU(xmm_o0, [reg_tmp])
+    PXOR(xmm_pad, xmm_o0)
+
+    LOAD.ARGUMENT(reg_tmp, k)
+    MOVDQU(xmm_i, [reg_tmp])
+    MOVDQU(xmm_j, [reg_tmp+16])
+    MOVDQU(xmm_l, [reg_tmp+32])
+
+    PXOR(xmm_zero, xmm_zero)
+
+    LOAD.ARGUMENT(reg_j, tiny_j)
+    LOAD.ARGUMENT(reg_step, step)
+    LOAD.ARGUMENT(reg_rounds, rounds)
+
+    # Process 2 rounds at a time in a loop.
+    out = Label()
+    SHR(reg_rounds, 1)
+    JZ(out)
+    rounds_loop = Loop()
+    with rounds_loop:
+        tinyRound(xmm_o0, xmm_right, xmm_left, xmm_mask, xmm_pad, reg_j, reg_step, reg_tmp, xmm_tmp0, xmm_j, xmm_i, xmm_l, xmm_zero)
+        tinyRound(xmm_o0, xmm_left, xmm_right, xmm_mask, xmm_pad, reg_j, reg_step, reg_tmp, xmm_tmp0, xmm_j, xmm_i, xmm_l, xmm_zero)
+
+        DEC(reg_rounds)
+        JNZ(rounds_loop.begin)
+
+    LABEL(out)
+
+    # Write back the halves.
+    MOVDQU([reg_left], xmm_left)
+    MOVDQU([reg_right], xmm_right)
+
+    RETURN()
+
+buf = Argument(ptr(uint8_t))
+
+with Function("aezAES4BlocksAMD64AESNI", (k, buf, blocks), target=uarch.zen):
+    reg_k = GeneralPurposeRegister64()
+    reg_buf = GeneralPurposeRegister64()
+    reg_blocks = GeneralPurposeRegister64()
+
+    LOAD.ARGUMENT(reg_k, k)
+    LOAD.ARGUMENT(reg_buf, buf)       # buf pointer
+    LOAD.ARGUMENT(reg_blocks, blocks) # blocks remaining
+
+    xmm_i = XMMRegister()    # AESENC Round key I
+    xmm_j = XMMRegister()    # AESENC Round key J
+    xmm_l = XMMRegister()    # AESENC Round Key L
+    xmm_zero = XMMRegister() # [16]byte{0x00}
+
+    xmm_o = [XMMRegister() for _ in range(8)]
+
+    MOVDQU(xmm_i, [reg_k])
+    MOVDQU(xmm_j, [reg_k+16])
+    MOVDQU(xmm_l, [reg_k+32])
+    PXOR(xmm_zero, xmm_zero)
+
+    # Process 8 independent blocks at a time in a loop.
+    vector_loop8 = Loop()
+    SUB(reg_blocks, 8)
+    JB(vector_loop8.end)
+    with vector_loop8:
+        # o[n] = aes4(buf[n], keys), where the caller has already
+        # applied the J ^ I ^ L whitening for each block.
+        for n in range(8):
+            MOVDQU(xmm_o[n], [reg_buf+16*n])
+        aesenc4x8(xmm_o[0], xmm_o[1], xmm_o[2], xmm_o[3], xmm_o[4], xmm_o[5], xmm_o[6], xmm_o[7], xmm_j, xmm_i, xmm_l, xmm_zero)
+        for n in range(8):
+            MOVDQU([reg_buf+16*n], xmm_o[n])
+
+        # Update book keeping.
+        ADD(reg_buf, 128)
+        SUB(reg_blocks, 8)
+        JAE(vector_loop8.begin)
+    ADD(reg_blocks, 8)
+
+    # Process 1 block at a time in a loop.
+    out = Label()
+    SUB(reg_blocks, 1)
+    JB(out)
+    process_16bytes_loop = Loop()
+    with process_16bytes_loop:
+        MOVDQU(xmm_o[0], [reg_buf])
+        aesenc4x1(xmm_o[0], xmm_j, xmm_i, xmm_l, xmm_zero)
+        MOVDQU([reg_buf], xmm_o[0])
+
+        # Update book keeping.
+        ADD(reg_buf, 16)
+        SUB(reg_blocks, 1)
+        JAE(process_16bytes_loop.begin)
+
+    LABEL(out)
+
+    RETURN()
+
+with Function("aezAES10BlocksAMD64AESNI", (k, buf, blocks), target=uarch.zen):
+    reg_k = GeneralPurposeRegister64()
+    reg_buf = GeneralPurposeRegister64()
+    reg_blocks = GeneralPurposeRegister64()
+
+    LOAD.ARGUMENT(reg_k, k)
+    LOAD.ARGUMENT(reg_buf, buf)       # buf pointer
+    LOAD.ARGUMENT(reg_blocks, blocks) # blocks remaining
+
+    xmm_i = XMMRegister()    # AESENC Round key I
+    xmm_j = XMMRegister()    # AESENC Round key J
+    xmm_l = XMMRegister()    # AESENC Round Key L
+
+    xmm_o = [XMMRegister() for _ in range(8)]
+
+    MOVDQU(xmm_i, [reg_k])
+    MOVDQU(xmm_j, [reg_k+16])
+    MOVDQU(xmm_l, [reg_k+32])
+
+    # Process 8 independent blocks at a time in a loop.
+    vector_loop8 = Loop()
+    SUB(reg_blocks, 8)
+    JB(vector_loop8.end)
+    with vector_loop8:
+        # o[n] = aes10(buf[n], keys), where the caller has already
+        # applied the L whitening for each block.
+        for n in range(8):
+            MOVDQU(xmm_o[n], [reg_buf+16*n])
+        for key in [xmm_i, xmm_j, xmm_l, xmm_i, xmm_j, xmm_l, xmm_i, xmm_j, xmm_l, xmm_i]:
+            for n in range(8):
+                AESENC(xmm_o[n], key)
+        for n in range(8):
+            MOVDQU([reg_buf+16*n], xmm_o[n])
+
+        # Update book keeping.
+        ADD(reg_buf, 128)
+        SUB(reg_blocks, 8)
+        JAE(vector_loop8.begin)
+    ADD(reg_blocks, 8)
+
+    # Process 1 block at a time in a loop.
+    out = Label()
+    SUB(reg_blocks, 1)
+    JB(out)
+    process_16bytes_loop = Loop()
+    with process_16bytes_loop:
+        MOVDQU(xmm_o[0], [reg_buf])
+        for key in [xmm_i, xmm_j, xmm_l, xmm_i, xmm_j, xmm_l, xmm_i, xmm_j, xmm_l, xmm_i]:
+            AESENC(xmm_o[0], key)
+        MOVDQU([reg_buf], xmm_o[0])
+
+        # Update book keeping.
+        ADD(reg_buf, 16)
+        SUB(reg_blocks, 1)
+        JAE(process_16bytes_loop.begin)
+
+    LABEL(out)
+
+    RETURN()
+
 with Function("aezCorePass1AMD64AESNI", (src, dst, x, i, l, k, consts, sz), target=uarch.zen):
     # This would be better as a port of the aesni pass_one() routine,
     # however that requires storing some intermediaries in reversed
@@ -367,14 +882,22 @@ with Function("aezCorePass1AMD64AESNI", (src, dst, x, i, l, k, consts, sz), targ
         PXOR(xmm_o5, xmm_tmp0)
         PXOR(xmm_o6, xmm_tmp0)
         PXOR(xmm_o7, xmm_tmp0)
-        PXOR(xmm_o0, [reg_l+16])  # L[1]
-        PXOR(xmm_o1, [reg_l+32])  # L[2]
-        PXOR(xmm_o2, [reg_l+48])  # L[3]
-        PXOR(xmm_o3, [reg_l+64])  # L[4]
-        PXOR(xmm_o4, [reg_l+80])  # L[5]
-        PXOR(xmm_o5, [reg_l+96])  # L[6]
-        PXOR(xmm_o6, [reg_l+112]) # L[7]
-        PXOR(xmm_o7, [reg_l])     # L[0]
+        MOVDQU(xmm_tmp1, [reg_l+16])
+        PXOR(xmm_o0, xmm_tmp1)  # L[1]
+        MOVDQU(xmm_tmp1, [reg_l+32])
+        PXOR(xmm_o1, xmm_tmp1)  # L[2]
+        MOVDQU(xmm_tmp1, [reg_l+48])
+        PXOR(xmm_o2, xmm_tmp1)  # L[3]
+        MOVDQU(xmm_tmp1, [reg_l+64])
+        PXOR(xmm_o3, xmm_tmp1)  # L[4]
+        MOVDQU(xmm_tmp1, [reg_l+80])
+        PXOR(xmm_o4, xmm_tmp1)  # L[5]
+        MOVDQU(xmm_tmp1, [reg_l+96])
+        PXOR(xmm_o5, xmm_tmp1)  # L[6]
+        MOVDQU(xmm_tmp1, [reg_l+112])
+        PXOR(xmm_o6, xmm_tmp1) # L[7]
+        MOVDQU(xmm_tmp1, [reg_l])
+        PXOR(xmm_o7, xmm_tmp1)     # L[0]
         aesenc4x8(xmm_o0, xmm_o1, xmm_o2, xmm_o3, xmm_o4, xmm_o5, xmm_o6, xmm_o7, xmm_j, xmm_i, xmm_l, xmm_zero)
 
         # dst[  :] = in[  :] ^ o0
@@ -514,10 +1037,14 @@ with Function("aezCorePass1AMD64AESNI", (src, dst, x, i, l, k, consts, sz), targ
     PXOR(xmm_o1, xmm_tmp0)
     PXOR(xmm_o2, xmm_tmp0)
     PXOR(xmm_o3, xmm_tmp0)
-    PXOR(xmm_o0, [reg_l+16]) # L[1]
-    PXOR(xmm_o1, [reg_l+32]) # L[2]
-    PXOR(xmm_o2, [reg_l+48]) # L[3]
-    PXOR(xmm_o3, [reg_l+64]) # L[4]
+    MOVDQU(xmm_tmp1, [reg_l+16])
+    PXOR(xmm_o0, xmm_tmp1) # L[1]
+    MOVDQU(xmm_tmp1, [reg_l+32])
+    PXOR(xmm_o1, xmm_tmp1) # L[2]
+    MOVDQU(xmm_tmp1, [reg_l+48])
+    PXOR(xmm_o2, xmm_tmp1) # L[3]
+    MOVDQU(xmm_tmp1, [reg_l+64])
+    PXOR(xmm_o3, xmm_tmp1) # L[4]
     aesenc4x4(xmm_o0, xmm_o1, xmm_o2, xmm_o3, xmm_j, xmm_i, xmm_l, xmm_zero)
 
     # dst[  :] = in[  :] ^ o0
@@ -597,8 +1124,10 @@ with Function("aezCorePass1AMD64AESNI", (src, dst, x, i, l, k, consts, sz), targ
     PXOR(xmm_o1, xmm_j)
     PXOR(xmm_o0, xmm_iDbl)
     PXOR(xmm_o1, xmm_iDbl)
-    PXOR(xmm_o0, [reg_l_offset])    # L[i]
-    PXOR(xmm_o1, [reg_l_offset+16]) # L[i+1]
+    MOVDQU(xmm_tmp1, [reg_l_offset])
+    PXOR(xmm_o0, xmm_tmp1)    # L[i]
+    MOVDQU(xmm_tmp1, [reg_l_offset+16])
+    PXOR(xmm_o1, xmm_tmp1) # L[i+1]
     aesenc4x2(xmm_o0, xmm_o1, xmm_j, xmm_i, xmm_l, xmm_zero)
 
     # dst[:  ] = in[:  ] ^ o0
@@ -654,7 +1183,8 @@ with Function("aezCorePass1AMD64AESNI", (src, dst, x, i, l, k, consts, sz), targ
     MOVDQA(xmm_o0, xmm_src_r0)
     PXOR(xmm_o0, xmm_j)
     PXOR(xmm_o0, xmm_iDbl)
-    PXOR(xmm_o0, [reg_l])
+    MOVDQU(xmm_tmp1, [reg_l])
+    PXOR(xmm_o0, xmm_tmp1)
     aesenc4x1(xmm_o0, xmm_j, xmm_i, xmm_l, xmm_zero)
 
     # dst[:] = in[:] ^ o0
@@ -735,7 +1265,8 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
 
     LOAD.ARGUMENT(reg_s, s)
     MOVDQU(xmm_s, [reg_s])
-    PXOR(xmm_s, [reg_j+16]) # S ^= J[1] (Once per call, in theory)
+    MOVDQU(xmm_tmp0, [reg_j+16])
+    PXOR(xmm_s, xmm_tmp0) # S ^= J[1] (Once per call, in theory)
 
     # Save the stack pointer, align stack to 32 bytes, and allocate
     # 256 bytes of scratch space.
@@ -782,14 +1313,22 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
         MOVDQA(xmm_o5, xmm_o0)    # o2 = o1
         MOVDQA(xmm_o6, xmm_o0)    # o3 = o1
         MOVDQA(xmm_o7, xmm_o0)    # o3 = o1
-        PXOR(xmm_o0, [reg_l+16])  # o0 ^= L[1]
-        PXOR(xmm_o1, [reg_l+32])  # o1 ^= L[2]
-        PXOR(xmm_o2, [reg_l+48])  # o2 ^= L[3]
-        PXOR(xmm_o3, [reg_l+64])  # o3 ^= L[4]
-        PXOR(xmm_o4, [reg_l+80])  # o4 ^= L[5]
-        PXOR(xmm_o5, [reg_l+96])  # o5 ^= L[6]
-        PXOR(xmm_o6, [reg_l+112]) # o6 ^= L[7]
-        PXOR(xmm_o7, [reg_l])     # o7 ^= L[0]
+        MOVDQU(xmm_tmp0, [reg_l+16])
+        PXOR(xmm_o0, xmm_tmp0)  # o0 ^= L[1]
+        MOVDQU(xmm_tmp0, [reg_l+32])
+        PXOR(xmm_o1, xmm_tmp0)  # o1 ^= L[2]
+        MOVDQU(xmm_tmp0, [reg_l+48])
+        PXOR(xmm_o2, xmm_tmp0)  # o2 ^= L[3]
+        MOVDQU(xmm_tmp0, [reg_l+64])
+        PXOR(xmm_o3, xmm_tmp0)  # o3 ^= L[4]
+        MOVDQU(xmm_tmp0, [reg_l+80])
+        PXOR(xmm_o4, xmm_tmp0)  # o4 ^= L[5]
+        MOVDQU(xmm_tmp0, [reg_l+96])
+        PXOR(xmm_o5, xmm_tmp0)  # o5 ^= L[6]
+        MOVDQU(xmm_tmp0, [reg_l+112])
+        PXOR(xmm_o6, xmm_tmp0) # o6 ^= L[7]
+        MOVDQU(xmm_tmp0, [reg_l])
+        PXOR(xmm_o7, xmm_tmp0)     # o7 ^= L[0]
         aesenc4x8(xmm_o0, xmm_o1, xmm_o2, xmm_o3, xmm_o4, xmm_o5, xmm_o6, xmm_o7, xmm_j, xmm_i, xmm_l, xmm_zero)
 
         # TODO: Figure out how the fuck to remove some of these loads/stores.
@@ -903,7 +1442,7 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
         #  ...
         # o6 = aes4(o0 ^ J[0] ^ I ^ L[7]) // E(1,7)
         # o7 = aes4(o0 ^ J[0] ^ I ^ L[0]) // E(1,0)
-        MOVDQA(xmm_tmp0, [reg_j])
+        MOVDQU(xmm_tmp0, [reg_j])
         PXOR(xmm_tmp0, xmm_iDbl)  # tmp = J[0] ^ I
         PXOR(xmm_o0, xmm_tmp0)    # o0 ^= tmp
         PXOR(xmm_o1, xmm_tmp0)    # o1 ^= tmp
@@ -913,14 +1452,22 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
         PXOR(xmm_o5, xmm_tmp0)    # o5 ^= tmp
         PXOR(xmm_o6, xmm_tmp0)    # o6 ^= tmp
         PXOR(xmm_o7, xmm_tmp0)    # o7 ^= tmp
-        PXOR(xmm_o0, [reg_l+16])  # o0 ^= L[1]
-        PXOR(xmm_o1, [reg_l+32])  # o1 ^= L[2]
-        PXOR(xmm_o2, [reg_l+48])  # o2 ^= L[3]
-        PXOR(xmm_o3, [reg_l+64])  # o3 ^= L[4]
-        PXOR(xmm_o4, [reg_l+80])  # o4 ^= L[5]
-        PXOR(xmm_o5, [reg_l+96])  # o5 ^= L[6]
-        PXOR(xmm_o6, [reg_l+112]) # o6 ^= L[7]
-        PXOR(xmm_o7, [reg_l])     # o7 ^= L[0]
+        MOVDQU(xmm_tmp0, [reg_l+16])
+        PXOR(xmm_o0, xmm_tmp0)  # o0 ^= L[1]
+        MOVDQU(xmm_tmp0, [reg_l+32])
+        PXOR(xmm_o1, xmm_tmp0)  # o1 ^= L[2]
+        MOVDQU(xmm_tmp0, [reg_l+48])
+        PXOR(xmm_o2, xmm_tmp0)  # o2 ^= L[3]
+        MOVDQU(xmm_tmp0, [reg_l+64])
+        PXOR(xmm_o3, xmm_tmp0)  # o3 ^= L[4]
+        MOVDQU(xmm_tmp0, [reg_l+80])
+        PXOR(xmm_o4, xmm_tmp0)  # o4 ^= L[5]
+        MOVDQU(xmm_tmp0, [reg_l+96])
+        PXOR(xmm_o5, xmm_tmp0)  # o5 ^= L[6]
+        MOVDQU(xmm_tmp0, [reg_l+112])
+        PXOR(xmm_o6, xmm_tmp0) # o6 ^= L[7]
+        MOVDQU(xmm_tmp0, [reg_l])
+        PXOR(xmm_o7, xmm_tmp0)     # o7 ^= L[0]
         aesenc4x8(xmm_o0, xmm_o1, xmm_o2, xmm_o3, xmm_o4, xmm_o5, xmm_o6, xmm_o7, xmm_j, xmm_i, xmm_l, xmm_zero)
 
         # dst_r0 ^= o0, ... dst_r7 ^= o7
@@ -949,7 +1496,8 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
         doubleBlock(xmm_iDbl, xmm_tmp0, xmm_tmp1, reg_tmp)
 
         MOVDQU(xmm_s, [reg_s])
-        PXOR(xmm_s, [reg_j+16])  # Re-derive since it was used as scratch space.
+        MOVDQU(xmm_tmp0, [reg_j+16])
+        PXOR(xmm_s, xmm_tmp0)  # Re-derive since it was used as scratch space.
 
         # Update book keeping.
         ADD(reg_dst, 256)
@@ -993,10 +1541,14 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
     MOVDQA(xmm_o1, xmm_o0)   # o1 = o0
     MOVDQA(xmm_o2, xmm_o0)   # o2 = o0
     MOVDQA(xmm_o3, xmm_o0)   # o3 = o0
-    PXOR(xmm_o0, [reg_l+16]) # o0 ^= L[1]
-    PXOR(xmm_o1, [reg_l+32]) # o1 ^= L[2]
-    PXOR(xmm_o2, [reg_l+48]) # o2 ^= L[3]
-    PXOR(xmm_o3, [reg_l+64]) # o3 ^= L[4]
+    MOVDQU(xmm_tmp0, [reg_l+16])
+    PXOR(xmm_o0, xmm_tmp0) # o0 ^= L[1]
+    MOVDQU(xmm_tmp0, [reg_l+32])
+    PXOR(xmm_o1, xmm_tmp0) # o1 ^= L[2]
+    MOVDQU(xmm_tmp0, [reg_l+48])
+    PXOR(xmm_o2, xmm_tmp0) # o2 ^= L[3]
+    MOVDQU(xmm_tmp0, [reg_l+64])
+    PXOR(xmm_o3, xmm_tmp0) # o3 ^= L[4]
     aesenc4x4(xmm_o0, xmm_o1, xmm_o2, xmm_o3, xmm_j, xmm_i, xmm_l, xmm_zero)
 
     # Load the left halfs of the dsts into registers.
@@ -1075,18 +1627,26 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
     # o1 = aes4(o1 ^ J[0] ^ I ^ L[2]) // E(1,2)
     # o2 = aes4(o2 ^ J[0] ^ I ^ L[3]) // E(1,3)
     # o3 = aes4(o3 ^ J[0] ^ I ^ L[4]) // E(1,4)
-    PXOR(xmm_o0, [reg_j])
-    PXOR(xmm_o1, [reg_j])
-    PXOR(xmm_o2, [reg_j])
-    PXOR(xmm_o3, [reg_j])
+    MOVDQU(xmm_tmp0, [reg_j])
+    PXOR(xmm_o0, xmm_tmp0)
+    MOVDQU(xmm_tmp0, [reg_j])
+    PXOR(xmm_o1, xmm_tmp0)
+    MOVDQU(xmm_tmp0, [reg_j])
+    PXOR(xmm_o2, xmm_tmp0)
+    MOVDQU(xmm_tmp0, [reg_j])
+    PXOR(xmm_o3, xmm_tmp0)
     PXOR(xmm_o0, xmm_iDbl)
     PXOR(xmm_o1, xmm_iDbl)
     PXOR(xmm_o2, xmm_iDbl)
     PXOR(xmm_o3, xmm_iDbl)
-    PXOR(xmm_o0, [reg_l+16]) # o0 ^= L[1]
-    PXOR(xmm_o1, [reg_l+32]) # o1 ^= L[2]
-    PXOR(xmm_o2, [reg_l+48]) # o2 ^= L[3]
-    PXOR(xmm_o3, [reg_l+64]) # o3 ^= L[4]
+    MOVDQU(xmm_tmp0, [reg_l+16])
+    PXOR(xmm_o0, xmm_tmp0) # o0 ^= L[1]
+    MOVDQU(xmm_tmp0, [reg_l+32])
+    PXOR(xmm_o1, xmm_tmp0) # o1 ^= L[2]
+    MOVDQU(xmm_tmp0, [reg_l+48])
+    PXOR(xmm_o2, xmm_tmp0) # o2 ^= L[3]
+    MOVDQU(xmm_tmp0, [reg_l+64])
+    PXOR(xmm_o3, xmm_tmp0) # o3 ^= L[4]
     aesenc4x4(xmm_o0, xmm_o1, xmm_o2, xmm_o3, xmm_j, xmm_i, xmm_l, xmm_zero)
 
     # dst_r0 ^= o0, ... dst_r3 ^= o3
@@ -1130,8 +1690,10 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
     MOVDQA(xmm_o0, xmm_s)
     PXOR(xmm_o0, xmm_iDbl)          # o0 = s ^ I
     MOVDQA(xmm_o1, xmm_o0)          # o1 = o0
-    PXOR(xmm_o0, [reg_l_offset])    # o0 ^= L[i]
-    PXOR(xmm_o1, [reg_l_offset+16]) # o1 ^= L[i+1]
+    MOVDQU(xmm_tmp0, [reg_l_offset])
+    PXOR(xmm_o0, xmm_tmp0)    # o0 ^= L[i]
+    MOVDQU(xmm_tmp0, [reg_l_offset+16])
+    PXOR(xmm_o1, xmm_tmp0) # o1 ^= L[i+1]
     aesenc4x2(xmm_o0, xmm_o1, xmm_j, xmm_i, xmm_l, xmm_zero)
 
     # Load dst into registers.
@@ -1170,12 +1732,16 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
 
     # o0 = aes4(o0 ^ J[0] ^ I ^ L[(i+0)%8]) // E(1,i)
     # o1 = aes4(o1 ^ J[0] ^ I ^ L[(i+1)%8]) // E(1,i+1)
-    PXOR(xmm_o0, [reg_j])
-    PXOR(xmm_o1, [reg_j])
+    MOVDQU(xmm_tmp0, [reg_j])
+    PXOR(xmm_o0, xmm_tmp0)
+    MOVDQU(xmm_tmp0, [reg_j])
+    PXOR(xmm_o1, xmm_tmp0)
     PXOR(xmm_o0, xmm_iDbl)
     PXOR(xmm_o1, xmm_iDbl)
-    PXOR(xmm_o0, [reg_tmp])
-    PXOR(xmm_o1, [reg_tmp+16])
+    MOVDQU(xmm_tmp0, [reg_tmp])
+    PXOR(xmm_o0, xmm_tmp0)
+    MOVDQU(xmm_tmp0, [reg_tmp+16])
+    PXOR(xmm_o1, xmm_tmp0)
     aesenc4x2(xmm_o0, xmm_o1, xmm_j, xmm_i, xmm_l, xmm_zero)
 
     # dst_r0 ^= o0
@@ -1213,7 +1779,8 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
     # o0 = aes4(J[1] ^ I ^ L[i%8] ^ S[:], keys) // E(1,i)
     MOVDQA(xmm_o0, xmm_s)  # o0 = s
     PXOR(xmm_o0, xmm_iDbl) # o0 ^= I
-    PXOR(xmm_o0, [reg_l])  # L[i%8]
+    MOVDQU(xmm_tmp0, [reg_l])
+    PXOR(xmm_o0, xmm_tmp0)  # L[i%8]
     aesenc4x1(xmm_o0, xmm_j, xmm_i, xmm_l, xmm_zero)
 
     # Load dst into registers.
@@ -1239,9 +1806,11 @@ with Function("aezCorePass2AMD64AESNI", (dst, y, s, j, i, l, k, consts, sz), tar
     MOVDQA(xmm_dst_l0, xmm_o0) # o0 = dst_l
 
     # o0 = aes4(o0 ^ J[0] ^ I ^ L[i%8]) // E(1,i)
-    PXOR(xmm_o0, [reg_j])
+    MOVDQU(xmm_tmp0, [reg_j])
+    PXOR(xmm_o0, xmm_tmp0)
     PXOR(xmm_o0, xmm_iDbl)
-    PXOR(xmm_o0, [reg_l])
+    MOVDQU(xmm_tmp0, [reg_l])
+    PXOR(xmm_o0, xmm_tmp0)
     aesenc4x1(xmm_o0, xmm_j, xmm_i, xmm_l, xmm_zero)
 
     # dst_r ^= o0
@@ -71,16 +71,16 @@ TEXT ·aezAES4AMD64AESNI(SB),4,$0-48
 	MOVQ src+32(FP), DI
 	MOVQ dst+40(FP), SI
 	MOVOU 0(DI), X0
-	MOVO 0(AX), X1
-	MOVO 0(BX), X2
-	MOVO 0(CX), X3
+	MOVOU 0(AX), X1
+	MOVOU 0(BX), X2
+	MOVOU 0(CX), X3
 	PXOR X1, X0
 	PXOR X3, X2
 	PXOR X2, X0
 	PXOR X4, X4
-	MOVO 0(DX), X2
-	MOVO 16(DX), X1
-	MOVO 32(DX), X3
+	MOVOU 0(DX), X2
+	MOVOU 16(DX), X1
+	MOVOU 32(DX), X3
 	AESENC X1, X0
 	AESENC X2, X0
 	AESENC X3, X0
@@ -97,9 +97,9 @@ TEXT ·aezAES10AMD64AESNI(SB),4,$0-32
 	MOVOU 0(CX), X0
 	MOVOU 0(AX), X1
 	PXOR X1, X0
-	MOVO 0(BX), X2
-	MOVO 16(BX), X3
-	MOVO 32(BX), X1
+	MOVOU 0(BX), X2
+	MOVOU 16(BX), X3
+	MOVOU 32(BX), X1
 	AESENC X2, X0
 	AESENC X3, X0
 	AESENC X1, X0
@@ -113,6 +113,575 @@ TEXT ·aezAES10AMD64AESNI(SB),4,$0-32
 	MOVOU X0, 0(DX)
 	RET
 
+// func aezHashBlocksAMD64AESNI(src *uint8, sum *uint8, j *uint8, i *uint8, l *uint8, k *uint8, consts *uint8, sz *uint)
+TEXT ·aezHashBlocksAMD64AESNI(SB),4,$0-64
+	MOVQ src+0(FP), AX
+	MOVQ sum+8(FP), BX
+	MOVQ l+32(FP), DX
+	MOVQ sz+56(FP), DI
+	MOVQ $1, SI
+	MOVOU 0(BX), X0
+	MOVQ j+16(FP), CX
+	MOVOU 0(CX), X14
+	MOVQ i+24(FP), CX
+	MOVOU 0(CX), X1
+	MOVQ k+40(FP), CX
+	MOVOU 0(CX), X2
+	MOVOU 16(CX), X3
+	MOVOU 32(CX), X4
+	MOVQ consts+48(FP), CX
+	PXOR X5, X5
+	SUBQ $128, DI
+	JCS vector_loop128_end
+vector_loop128_begin:
+		MOVOU 0(AX), X6
+		MOVOU 16(AX), X7
+		MOVOU 32(AX), X8
+		MOVOU 48(AX), X9
+		MOVOU 64(AX), X10
+		MOVOU 80(AX), X11
+		MOVOU 96(AX), X12
+		MOVOU 112(AX), X13
+		MOVO X14, X15
+		PXOR X1, X15
+		PXOR X15, X6
+		PXOR X15, X7
+		PXOR X15, X8
+		PXOR X15, X9
+		PXOR X15, X10
+		PXOR X15, X11
+		PXOR X15, X12
+		PXOR X15, X13
+		MOVOU 16(DX), X15
+		PXOR X15, X6
+		MOVOU 32(DX), X15
+		PXOR X15, X7
+		MOVOU 48(DX), X15
+		PXOR X15, X8
+		MOVOU 64(DX), X15
+		PXOR X15, X9
+		MOVOU 80(DX), X15
+		PXOR X15, X10
+		MOVOU 96(DX), X15
+		PXOR X15, X11
+		MOVOU 112(DX), X15
+		PXOR X15, X12
+		MOVOU 0(DX), X15
+		PXOR X15, X13
+		AESENC X3, X6
+		AESENC X3, X7
+		AESENC X3, X8
+		AESENC X3, X9
+		AESENC X3, X10
+		AESENC X3, X11
+		AESENC X3, X12
+		AESENC X3, X13
+		AESENC X2, X6
+		AESENC X2, X7
+		AESENC X2, X8
+		AESENC X2, X9
+		AESENC X2, X10
+		AESENC X2, X11
+		AESENC X2, X12
+		AESENC X2, X13
+		AESENC X4, X6
+		AESENC X4, X7
+		AESENC X4, X8
+		AESENC X4, X9
+		AESENC X4, X10
+		AESENC X4, X11
+		AESENC X4, X12
+		AESENC X4, X13
+		AESENC X5, X6
+		AESENC X5, X7
+		AESENC X5, X8
+		AESENC X5, X9
+		AESENC X5, X10
+		AESENC X5, X11
+		AESENC X5, X12
+		AESENC X5, X13
+		PXOR X6, X0
+		PXOR X7, X0
+		PXOR X8, X0
+		PXOR X9, X0
+		PXOR X10, X0
+		PXOR X11, X0
+		PXOR X12, X0
+		PXOR X13, X0
+		MOVO 0(CX), X15
+		PSHUFB X15, X1
+		MOVO X1, X6
+		PSRAL $31, X6
+		PAND 16(CX), X6
+		PSHUFL $147, X6, X6
+		PSLLL $1, X1
+		PXOR X6, X1
+		PSHUFB X15, X1
+		ADDQ $128, AX
+		SUBQ $128, DI
+		JCC vector_loop128_begin
+vector_loop128_end:
+	ADDQ $128, DI
+	SUBQ $64, DI
+	JCS process_16bytes
+	MOVOU 0(AX), X6
+	MOVOU 16(AX), X7
+	MOVOU 32(AX), X8
+	MOVOU 48(AX), X9
+	MOVO X14, X15
+	PXOR X1, X15
+	PXOR X15, X6
+	PXOR X15, X7
+	PXOR X15, X8
+	PXOR X15, X9
+	MOVOU 16(DX), X15
+	PXOR X15, X6
+	MOVOU 32(DX), X15
+	PXOR X15, X7
+	MOVOU 48(DX), X15
+	PXOR X15, X8
+	MOVOU 64(DX), X15
+	PXOR X15, X9
+	AESENC X3, X6
+	AESENC X3, X7
+	AESENC X3, X8
+	AESENC X3, X9
+	AESENC X2, X6
+	AESENC X2, X7
+	AESENC X2, X8
+	AESENC X2, X9
+	AESENC X4, X6
+	AESENC X4, X7
+	AESENC X4, X8
+	AESENC X4, X9
+	AESENC X5, X6
+	AESENC X5, X7
+	AESENC X5, X8
+	AESENC X5, X9
+	PXOR X6, X0
+	PXOR X7, X0
+	PXOR X8, X0
+	PXOR X9, X0
+	ADDQ $64, AX
+	ADDQ $4, SI
+	SUBQ $64, DI
+process_16bytes:
+	ADDQ $64, DI
+	MOVO X14, X15
+	PXOR X1, X15
+	SHLQ $4, SI
+	ADDQ SI, DX
+	SUBQ $16, DI
+	JCS out
+process_16bytes_loop:
+		MOVOU 0(AX), X6
+		PXOR X15, X6
+		MOVOU 0(DX), X7
+		PXOR X7, X6
+		AESENC X3, X6
+		AESENC X2, X6
+		AESENC X4, X6
+		AESENC X5, X6
+		PXOR X6, X0
+		ADDQ $16, AX
+		ADDQ $16, DX
+		SUBQ $16, DI
+		JCC process_16bytes_loop
+out:
+	MOVOU X0, 0(BX)
+	RET
+
+// func aezPRFAMD64AESNI(delta *uint8, l *uint8, k *uint8, dst *uint8, blocks uint)
+TEXT ·aezPRFAMD64AESNI(SB),4,$0-40
+	MOVQ delta+0(FP), AX
+	MOVQ l+8(FP), BX
+	MOVQ k+16(FP), CX
+	MOVQ dst+24(FP), DX
+	MOVQ blocks+32(FP), DI
+	XORQ SI, SI
+	MOVOU 0(AX), X0
+	MOVOU 0(BX), X1
+	PXOR X1, X0
+	MOVOU 0(CX), X2
+	MOVOU 16(CX), X3
+	MOVOU 32(CX), X4
+	SUBQ $4, DI
+	JCS vector_loop4_end
+vector_loop4_begin:
+		MOVQ SI, R8
+		BSWAPQ R8
+		MOVQ R8, X5
+		PSLLO $8, X5
+		PXOR X0, X5
+		INCQ SI
+		MOVQ SI, R8
+		BSWAPQ R8
+		MOVQ R8, X6
+		PSLLO $8, X6
+		PXOR X0, X6
+		INCQ SI
+		MOVQ SI, R8
+		BSWAPQ R8
+		MOVQ R8, X7
+		PSLLO $8, X7
+		PXOR X0, X7
+		INCQ SI
+		MOVQ SI, R8
+		BSWAPQ R8
+		MOVQ R8, X8
+		PSLLO $8, X8
+		PXOR X0, X8
+		INCQ SI
+		AESENC X2, X5
+		AESENC X2, X6
+		AESENC X2, X7
+		AESENC X2, X8
+		AESENC X3, X5
+		AESENC X3, X6
+		AESENC X3, X7
+		AESENC X3, X8
+		AESENC X4, X5
+		AESENC X4, X6
+		AESENC X4, X7
+		AESENC X4, X8
+		AESENC X2, X5
+		AESENC X2, X6
+		AESENC X2, X7
+		AESENC X2, X8
+		AESENC X3, X5
+		AESENC X3, X6
+		AESENC X3, X7
+		AESENC X3, X8
+		AESENC X4, X5
+		AESENC X4, X6
+		AESENC X4, X7
+		AESENC X4, X8
+		AESENC X2, X5
+		AESENC X2, X6
+		AESENC X2, X7
+		AESENC X2, X8
+		AESENC X3, X5
+		AESENC X3, X6
+		AESENC X3, X7
+		AESENC X3, X8
+		AESENC X4, X5
+		AESENC X4, X6
+		AESENC X4, X7
+		AESENC X4, X8
+		AESENC X2, X5
+		AESENC X2, X6
+		AESENC X2, X7
+		AESENC X2, X8
+		MOVOU X5, 0(DX)
+		MOVOU X6, 16(DX)
+		MOVOU X7, 32(DX)
+		MOVOU X8, 48(DX)
+		ADDQ $64, DX
+		SUBQ $4, DI
+		JCC vector_loop4_begin
+vector_loop4_end:
+	ADDQ $4, DI
+	SUBQ $1, DI
+	JCS out
+process_16bytes_loop:
+		MOVQ SI, R8
+		BSWAPQ R8
+		MOVQ R8, X5
+		PSLLO $8, X5
+		PXOR X0, X5
+		INCQ SI
+		AESENC X2, X5
+		AESENC X3, X5
+		AESENC X4, X5
+		AESENC X2, X5
+		AESENC X3, X5
+		AESENC X4, X5
+		AESENC X2, X5
+		AESENC X3, X5
+		AESENC X4, X5
+		AESENC X2, X5
+		MOVOU X5, 0(DX)
+		ADDQ $16, DX
+		SUBQ $1, DI
+		JCC process_16bytes_loop
+out:
+	RET
+
+// func aezTinyRoundsAMD64AESNI(left *uint8, right *uint8, mask *uint8, pad *uint8, i *uint8, l *uint8, k *uint8, j int, step int, rounds uint)
+TEXT ·aezTinyRoundsAMD64AESNI(SB),4,$0-80
+	MOVQ left+0(FP), AX
+	MOVQ right+8(FP), BX
+	MOVQ mask+16(FP), CX
+	MOVQ pad+24(FP), DX
+	MOVOU 0(AX), X0
+	MOVOU 0(BX), X1
+	MOVOU 0(CX), X6
+	MOVOU 0(DX), X7
+	MOVQ i+32(FP), CX
+	MOVOU 0(CX), X8
+	PXOR X8, X7
+	MOVQ l+40(FP), CX
+	MOVOU 0(CX), X8
+	PXOR X8, X7
+	MOVQ k+48(FP), CX
+	MOVOU 0(CX), X2
+	MOVOU 16(CX), X3
+	MOVOU 32(CX), X4
+	PXOR X5, X5
+	MOVQ j+56(FP), SI
+	MOVQ step+64(FP), DI
+	MOVQ rounds+72(FP), CX
+	SHRQ $1, CX
+	JEQ out
+rounds_loop:
+		MOVO X1, X8
+		PAND X6, X8
+		PXOR X7, X8
+		MOVQ SI, R8
+		SHLQ $56, R8
+		MOVQ R8, X9
+		PSLLO $8, X9
+		PXOR X9, X8
+		AESENC X3, X8
+		AESENC X2, X8
+		AESENC X4, X8
+		AESENC X5, X8
+		PXOR X8, X0
+		ADDQ DI, SI
+		MOVO X0, X8
+		PAND X6, X8
+		PXOR X7, X8
+		MOVQ SI, R8
+		SHLQ $56, R8
+		MOVQ R8, X9
+		PSLLO $8, X9
+		PXOR X9, X8
+		AESENC X3, X8
+		AESENC X2, X8
+		AESENC X4, X8
+		AESENC X5, X8
+		PXOR X8, X1
+		ADDQ DI, SI
+		DECQ CX
+		JNE rounds_loop
+out:
+	MOVOU X0, 0(AX)
+	MOVOU X1, 0(BX)
+	RET
+
+// func aezAES4BlocksAMD64AESNI(k *uint8, buf *uint8, blocks uint)
+TEXT ·aezAES4BlocksAMD64AESNI(SB),4,$0-24
+	MOVQ k+0(FP), AX
+	MOVQ buf+8(FP), BX
+	MOVQ blocks+16(FP), CX
+	MOVOU 0(AX), X8
+	MOVOU 16(AX), X9
+	MOVOU 32(AX), X10
+	PXOR X11, X11
+	SUBQ $8, CX
+	JCS vector_loop8_end
+vector_loop8_begin:
+		MOVOU 0(BX), X0
+		MOVOU 16(BX), X1
+		MOVOU 32(BX), X2
+		MOVOU 48(BX), X3
+		MOVOU 64(BX), X4
+		MOVOU 80(BX), X5
+		MOVOU 96(BX), X6
+		MOVOU 112(BX), X7
+		AESENC X9, X0
+		AESENC X9, X1
+		AESENC X9, X2
+		AESENC X9, X3
+		AESENC X9, X4
+		AESENC X9, X5
+		AESENC X9, X6
+		AESENC X9, X7
+		AESENC X8, X0
+		AESENC X8, X1
+		AESENC X8, X2
+		AESENC X8, X3
+		AESENC X8, X4
+		AESENC X8, X5
+		AESENC X8, X6
+		AESENC X8, X7
+		AESENC X10, X0
+		AESENC X10, X1
+		AESENC X10, X2
+		AESENC X10, X3
+		AESENC X10, X4
+		AESENC X10, X5
+		AESENC X10, X6
+		AESENC X10, X7
+		AESENC X11, X0
+		AESENC X11, X1
+		AESENC X11, X2
+		AESENC X11, X3
+		AESENC X11, X4
+		AESENC X11, X5
+		AESENC X11, X6
+		AESENC X11, X7
+		MOVOU X0, 0(BX)
+		MOVOU X1, 16(BX)
+		MOVOU X2, 32(BX)
+		MOVOU X3, 48(BX)
+		MOVOU X4, 64(BX)
+		MOVOU X5, 80(BX)
+		MOVOU X6, 96(BX)
+		MOVOU X7, 112(BX)
+		ADDQ $128, BX
+		SUBQ $8, CX
+		JCC vector_loop8_begin
+vector_loop8_end:
+	ADDQ $8, CX
+	SUBQ $1, CX
+	JCS out
+process_16bytes_loop:
+		MOVOU 0(BX), X0
+		AESENC X9, X0
+		AESENC X8, X0
+		AESENC X10, X0
+		AESENC X11, X0
+		MOVOU X0, 0(BX)
+		ADDQ $16, BX
+		SUBQ $1, CX
+		JCC process_16bytes_loop
+out:
+	RET
+
+// func aezAES10BlocksAMD64AESNI(k *uint8, buf *uint8, blocks uint)
+TEXT ·aezAES10BlocksAMD64AESNI(SB),4,$0-24
+	MOVQ k+0(FP), AX
+	MOVQ buf+8(FP), BX
+	MOVQ blocks+16(FP), CX
+	MOVOU 0(AX), X8
+	MOVOU 16(AX), X9
+	MOVOU 32(AX), X10
+	SUBQ $8, CX
+	JCS vector_loop8_end
+vector_loop8_begin:
+		MOVOU 0(BX), X0
+		MOVOU 16(BX), X1
+		MOVOU 32(BX), X2
+		MOVOU 48(BX), X3
+		MOVOU 64(BX), X4
+		MOVOU 80(BX), X5
+		MOVOU 96(BX), X6
+		MOVOU 112(BX), X7
+		AESENC X8, X0
+		AESENC X8, X1
+		AESENC X8, X2
+		AESENC X8, X3
+		AESENC X8, X4
+		AESENC X8, X5
+		AESENC X8, X6
+		AESENC X8, X7
+		AESENC X9, X0
+		AESENC X9, X1
+		AESENC X9, X2
+		AESENC X9, X3
+		AESENC X9, X4
+		AESENC X9, X5
+		AESENC X9, X6
+		AESENC X9, X7
+		AESENC X10, X0
+		AESENC X10, X1
+		AESENC X10, X2
+		AESENC X10, X3
+		AESENC X10, X4
+		AESENC X10, X5
+		AESENC X10, X6
+		AESENC X10, X7
+		AESENC X8, X0
+		AESENC X8, X1
+		AESENC X8, X2
+		AESENC X8, X3
+		AESENC X8, X4
+		AESENC X8, X5
+		AESENC X8, X6
+		AESENC X8, X7
+		AESENC X9, X0
+		AESENC X9, X1
+		AESENC X9, X2
+		AESENC X9, X3
+		AESENC X9, X4
+		AESENC X9, X5
+		AESENC X9, X6
+		AESENC X9, X7
+		AESENC X10, X0
+		AESENC X10, X1
+		AESENC X10, X2
+		AESENC X10, X3
+		AESENC X10, X4
+		AESENC X10, X5
+		AESENC X10, X6
+		AESENC X10, X7
+		AESENC X8, X0
+		AESENC X8, X1
+		AESENC X8, X2
+		AESENC X8, X3
+		AESENC X8, X4
+		AESENC X8, X5
+		AESENC X8, X6
+		AESENC X8, X7
+		AESENC X9, X0
+		AESENC X9, X1
+		AESENC X9, X2
+		AESENC X9, X3
+		AESENC X9, X4
+		AESENC X9, X5
+		AESENC X9, X6
+		AESENC X9, X7
+		AESENC X10, X0
+		AESENC X10, X1
+		AESENC X10, X2
+		AESENC X10, X3
+		AESENC X10, X4
+		AESENC X10, X5
+		AESENC X10, X6
+		AESENC X10, X7
+		AESENC X8, X0
+		AESENC X8, X1
+		AESENC X8, X2
+		AESENC X8, X3
+		AESENC X8, X4
+		AESENC X8, X5
+		AESENC X8, X6
+		AESENC X8, X7
+		MOVOU X0, 0(BX)
+		MOVOU X1, 16(BX)
+		MOVOU X2, 32(BX)
+		MOVOU X3, 48(BX)
+		MOVOU X4, 64(BX)
+		MOVOU X5, 80(BX)
+		MOVOU X6, 96(BX)
+		MOVOU X7, 112(BX)
+		ADDQ $128, BX
+		SUBQ $8, CX
+		JCC vector_loop8_begin
+vector_loop8_end:
+	ADDQ $8, CX
+	SUBQ $1, CX
+	JCS out
+process_16bytes_loop:
+		MOVOU 0(BX), X0
+		AESENC X8, X0
+		AESENC X9, X0
+		AESENC X10, X0
+		AESENC X8, X0
+		AESENC X9, X0
+		AESENC X10, X0
+		AESENC X8, X0
+		AESENC X9, X0
+		AESENC X10, X0
+		AESENC X8, X0
+		MOVOU X0, 0(BX)
+		ADDQ $16, BX
+		SUBQ $1, CX
+		JCC process_16bytes_loop
+out:
+	RET
+
 // func aezCorePass1AMD64AESNI(src *uint8, dst *uint8, x *uint8, i *uint8, l *uint8, k *uint8, consts *uint8, sz *uint)
 TEXT ·aezCorePass1AMD64AESNI(SB),4,$0-64
 	MOVQ src+0(FP), AX
@@ -151,14 +720,22 @@ vector_loop256_begin:
 		PXOR X14, X11
 		PXOR X14, X12
 		PXOR X14, X13
-		PXOR 16(DX), X6
-		PXOR 32(DX), X7
-		PXOR 48(DX), X8
-		PXOR 64(DX), X9
-		PXOR 80(DX), X10
-		PXOR 96(DX), X11
-		PXOR 112(DX), X12
-		PXOR 0(DX), X13
+		MOVOU 16(DX), X15
+		PXOR X15, X6
+		MOVOU 32(DX), X15
+		PXOR X15, X7
+		MOVOU 48(DX), X15
+		PXOR X15, X8
+		MOVOU 64(DX), X15
+		PXOR X15, X9
+		MOVOU 80(DX), X15
+		PXOR X15, X10
+		MOVOU 96(DX), X15
+		PXOR X15, X11
+		MOVOU 112(DX), X15
+		PXOR X15, X12
+		MOVOU 0(DX), X15
+		PXOR X15, X13
 		AESENC X3, X6
 		AESENC X3, X7
 		AESENC X3, X8
@@ -318,10 +895,14 @@ vector_loop256_end:
 	PXOR X14, X7
 	PXOR X14, X8
 	PXOR X14, X9
-	PXOR 16(DX), X6
-	PXOR 32(DX), X7
-	PXOR 48(DX), X8
-	PXOR 64(DX), X9
+	MOVOU 16(DX), X15
+	PXOR X15, X6
+	MOVOU 32(DX), X15
+	PXOR X15, X7
+	MOVOU 48(DX), X15
+	PXOR X15, X8
+	MOVOU 64(DX), X15
+	PXOR X15, X9
 	AESENC X3, X6
 	AESENC X3, X7
 	AESENC X3, X8
@@ -401,8 +982,10 @@ process_64bytes:
 	PXOR X3, X7
 	PXOR X1, X6
 	PXOR X1, X7
-	PXOR 0(BP), X6
-	PXOR 16(BP), X7
+	MOVOU 0(BP), X15
+	PXOR X15, X6
+	MOVOU 16(BP), X15
+	PXOR X15, X7
 	AESENC X3, X6
 	AESENC X3, X7
 	AESENC X2, X6
@@ -448,7 +1031,8 @@ process_32bytes:
 	MOVO X10, X6
 	PXOR X3, X6
 	PXOR X1, X6
-	PXOR 0(DX), X6
+	MOVOU 0(DX), X15
+	PXOR X15, X6
 	AESENC X3, X6
 	AESENC X2, X6
 	AESENC X4, X6
@@ -487,7 +1071,8 @@ TEXT ·aezCorePass2AMD64AESNI(SB),4,$0-72
 	PXOR X5, X5
 	MOVQ s+16(FP), R8
 	MOVOU 0(R8), X6
-	PXOR 16(CX), X6
+	MOVOU 16(CX), X15
+	PXOR X15, X6
 	MOVQ SP, R9
 	ANDQ $18446744073709551584, SP
 	SUBQ $256, SP
@@ -503,14 +1088,22 @@ vector_loop256_begin:
 		MOVO X7, X12
 		MOVO X7, X13
 		MOVO X7, X14
-		PXOR 16(DX), X7
-		PXOR 32(DX), X8
-		PXOR 48(DX), X9
-		PXOR 64(DX), X10
-		PXOR 80(DX), X11
-		PXOR 96(DX), X12
-		PXOR 112(DX), X13
-		PXOR 0(DX), X14
+		MOVOU 16(DX), X15
+		PXOR X15, X7
+		MOVOU 32(DX), X15
+		PXOR X15, X8
+		MOVOU 48(DX), X15
+		PXOR X15, X9
+		MOVOU 64(DX), X15
+		PXOR X15, X10
+		MOVOU 80(DX), X15
+		PXOR X15, X11
+		MOVOU 96(DX), X15
+		PXOR X15, X12
+		MOVOU 112(DX), X15
+		PXOR X15, X13
+		MOVOU 0(DX), X15
+		PXOR X15, X14
 		AESENC X1, X7
 		AESENC X1, X8
 		AESENC X1, X9
@@ -655,7 +1248,7 @@ vector_loop256_begin:
 		MOVOU X12, 176(AX)
 		MOVOU X13, 208(AX)
 		MOVOU X14, 240(AX)
-		MOVO 0(CX), X15
+		MOVOU 0(CX), X15
 		PXOR X4, X15
 		PXOR X15, X7
 		PXOR X15, X8
@@ -665,14 +1258,22 @@ vector_loop256_begin:
 		PXOR X15, X12
 		PXOR X15, X13
 		PXOR X15, X14
-		PXOR 16(DX), X7
-		PXOR 32(DX), X8
-		PXOR 48(DX), X9
-		PXOR 64(DX), X10
-		PXOR 80(DX), X11
-		PXOR 96(DX), X12
-		PXOR 112(DX), X13
-		PXOR 0(DX), X14
+		MOVOU 16(DX), X15
+		PXOR X15, X7
+		MOVOU 32(DX), X15
+		PXOR X15, X8
+		MOVOU 48(DX), X15
+		PXOR X15, X9
+		MOVOU 64(DX), X15
+		PXOR X15, X10
+		MOVOU 80(DX), X15
+		PXOR X15, X11
+		MOVOU 96(DX), X15
+		PXOR X15, X12
+		MOVOU 112(DX), X15
+		PXOR X15, X13
+		MOVOU 0(DX), X15
+		PXOR X15, X14
 		AESENC X1, X7
 		AESENC X1, X8
 		AESENC X1, X9
@@ -731,7 +1332,8 @@ vector_loop256_begin:
 		PXOR X6, X4
 		PSHUFB X15, X4
 		MOVOU 0(R8), X6
-		PXOR 16(CX), X6
+		MOVOU 16(CX), X15
+		PXOR X15, X6
 		ADDQ $256, AX
 		SUBQ $256, DI
 		JCC vector_loop256_begin
@@ -756,10 +1358,14 @@ vector_loop256_end:
 	MOVO X7, X8
 	MOVO X7, X9
 	MOVO X7, X10
-	PXOR 16(DX), X7
-	PXOR 32(DX), X8
-	PXOR 48(DX), X9
-	PXOR 64(DX), X10
+	MOVOU 16(DX), X15
+	PXOR X15, X7
+	MOVOU 32(DX), X15
+	PXOR X15, X8
+	MOVOU 48(DX), X15
+	PXOR X15, X9
+	MOVOU 64(DX), X15
+	PXOR X15, X10
 	AESENC X1, X7
 	AESENC X1, X8
 	AESENC X1, X9
@@ -836,18 +1442,26 @@ vector_loop256_end:
 	MOVOU X8, 48(AX)
 	MOVOU X9, 80(AX)
 	MOVOU X10, 112(AX)
-	PXOR 0(CX), X7
-	PXOR 0(CX), X8
-	PXOR 0(CX), X9
-	PXOR 0(CX), X10
+	MOVOU 0(CX), X15
+	PXOR X15, X7
+	MOVOU 0(CX), X15
+	PXOR X15, X8
+	MOVOU 0(CX), X15
+	PXOR X15, X9
+	MOVOU 0(CX), X15
+	PXOR X15, X10
 	PXOR X4, X7
 	PXOR X4, X8
 	PXOR X4, X9
 	PXOR X4, X10
-	PXOR 16(DX), X7
-	PXOR 32(DX), X8
-	PXOR 48(DX), X9
-	PXOR 64(DX), X10
+	MOVOU 16(DX), X15
+	PXOR X15, X7
+	MOVOU 32(DX), X15
+	PXOR X15, X8
+	MOVOU 48(DX), X15
+	PXOR X15, X9
+	MOVOU 64(DX), X15
+	PXOR X15, X10
 	AESENC X1, X7
 	AESENC X1, X8
 	AESENC X1, X9
@@ -885,8 +1499,10 @@ process_64bytes:
 	MOVO X6, X7
 	PXOR X4, X7
 	MOVO X7, X8
-	PXOR 0(BP), X7
-	PXOR 16(BP), X8
+	MOVOU 0(BP), X15
+	PXOR X15, X7
+	MOVOU 16(BP), X15
+	PXOR X15, X8
 	AESENC X1, X7
 	AESENC X1, X8
 	AESENC X0, X7
@@ -921,12 +1537,16 @@ process_64bytes:
 	PXOR X13, X8
 	MOVO X7, X11
 	MOVO X8, X13
-	PXOR 0(CX), X7
-	PXOR 0(CX), X8
+	MOVOU 0(CX), X15
+	PXOR X15, X7
+	MOVOU 0(CX), X15
+	PXOR X15, X8
 	PXOR X4, X7
 	PXOR X4, X8
-	PXOR 0(BP), X7
-	PXOR 16(BP), X8
+	MOVOU 0(BP), X15
+	PXOR X15, X7
+	MOVOU 16(BP), X15
+	PXOR X15, X8
 	AESENC X1, X7
 	AESENC X1, X8
 	AESENC X0, X7
@@ -953,7 +1573,8 @@ process_32bytes:
 	ADDQ SI, DX
 	MOVO X6, X7
 	PXOR X4, X7
-	PXOR 0(DX), X7
+	MOVOU 0(DX), X15
+	PXOR X15, X7
 	AESENC X1, X7
 	AESENC X0, X7
 	AESENC X2, X7
@@ -971,9 +1592,11 @@ process_32bytes:
 	AESENC X5, X7
 	PXOR X11, X7
 	MOVO X7, X11
-	PXOR 0(CX), X7
+	MOVOU 0(CX), X15
+	PXOR X15, X7
 	PXOR X4, X7
-	PXOR 0(DX), X7
+	MOVOU 0(DX), X15
+	PXOR X15, X7
 	AESENC X1, X7
 	AESENC X0, X7
 	AESENC X2, X7
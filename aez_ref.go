@@ -21,12 +21,44 @@ func xorBytes4x16(a, b, c, d, dst []byte) {
 	}
 }
 
-func (e *eState) aezCorePass1(in, out []byte, X *[blockSize]byte, sz int) {
-	e.aezCorePass1Slow(in, out, X, sz)
+func (e *eState) aes4(j, i, l *[blockSize]byte, src []byte, dst *[blockSize]byte) {
+	e.aes4Slow(j, i, l, src, dst)
 }
 
-func (e *eState) aezCorePass2(in, out []byte, Y, S *[blockSize]byte, sz int) {
-	e.aezCorePass2Slow(in, out, Y, S, sz)
+func (e *eState) aes10(l *[blockSize]byte, src []byte, dst *[blockSize]byte) {
+	e.aes10Slow(l, src, dst)
+}
+
+func (e *eState) aezHashBlocks(J *[blockSize]byte, in []byte, sum *[blockSize]byte) {
+	e.aezHashBlocksSlow(J, in, sum)
+}
+
+func (e *eState) aezPRF(delta *[blockSize]byte, tau int, result []byte) {
+	e.aezPRFSlow(delta, tau, result)
+}
+
+func (e *eState) aezTinyRounds(L, R, mask, pad *[blockSize]byte, i, j uint, step int, rounds uint) {
+	e.aezTinyRoundsSlow(L, R, mask, pad, i, j, step, rounds)
+}
+
+func (e *eState) aes4Blocks(buf []byte) {
+	e.aes4BlocksSlow(buf)
+}
+
+func (e *eState) aes10Blocks(buf []byte) {
+	e.aes10BlocksSlow(buf)
+}
+
+func (e *eState) batchCoreSize() int {
+	return maxBatchCoreSize
+}
+
+func (e *eState) aezCorePass1(in, out []byte, X, I *[blockSize]byte, sz int) {
+	e.aezCorePass1Slow(in, out, X, I, sz)
+}
+
+func (e *eState) aezCorePass2(in, out []byte, Y, S, I *[blockSize]byte, sz int) {
+	e.aezCorePass2Slow(in, out, Y, S, I, sz)
 }
 
 func platformInit() {
@@ -14,6 +14,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	mrand "math/rand"
 	"os"
 	"path/filepath"
 	"testing"
@@ -109,6 +110,180 @@ func TestHash(t *testing.T) {
 	}
 }
 
+func TestHashManyComponents(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	var e eState
+	defer e.reset()
+	e.init(key[:])
+
+	// The incrementally stepped multiples of J must match multBlock.
+	var J, expected [blockSize]byte
+	for _, r := range [][2]uint{{5, 1030}, {1<<16 - 10, 1<<16 + 10}, {1<<31 - 10, 1<<31 + 10}} {
+		multBlock(r[0], &e.J[0], &J)
+		for x := r[0]; x < r[1]; x++ {
+			e.nextJ(x, &J)
+			multBlock(x+1, &e.J[0], &expected)
+			assertEqual(t, int(x+1), expected[:], J[:])
+		}
+	}
+
+	// AEZ-hash of a vector with more than 512 elements must match the sum
+	// of the hashes of each element with the multiple of J computed via
+	// multBlock.
+	ad := make([][]byte, 600)
+	for i := range ad {
+		ad[i] = make([]byte, i%40)
+		if _, err := rand.Read(ad[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range []int{1, 8, 64, 512, 600} {
+		e.aezHash(nil, nil, 128, expected[:])
+		for k, v := range ad[:n] {
+			e.aezHashAD([][]byte{v}, uint(k), &expected)
+		}
+		e.aezHash(nil, ad[:n], 128, J[:])
+		assertEqual(t, n, expected[:], J[:])
+	}
+}
+
+func TestAcceleratedPaths(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	var e eState
+	defer e.reset()
+	e.init(key[:])
+
+	rng := mrand.New(mrand.NewSource(0))
+	var J, delta, expected, actual [blockSize]byte
+	rng.Read(J[:])
+	rng.Read(delta[:])
+
+	// AEZ-hash of full blocks, across the doubling of I every 8 blocks.
+	in := make([]byte, 64*blockSize)
+	rng.Read(in)
+	for n := 0; n <= len(in); n += blockSize {
+		copy(expected[:], delta[:])
+		copy(actual[:], delta[:])
+		e.aezHashBlocksRef(&J, in[:n], &expected)
+		e.aezHashBlocks(&J, in[:n], &actual)
+		assertEqual(t, n, expected[:], actual[:])
+	}
+
+	// AEZ-prf, with full and partial counter blocks.
+	for tau := 1; tau <= 300; tau++ {
+		x, y := make([]byte, tau), make([]byte, tau)
+		e.aezPRFRef(&delta, tau, x)
+		e.aezPRF(&delta, tau, y)
+		assertEqual(t, tau, x, y)
+	}
+
+	// AEZ-tiny Feistel rounds, in both directions.
+	for _, v := range []struct {
+		i, rounds uint
+	}{{7, 24}, {7, 16}, {7, 10}, {6, 8}} {
+		for _, d := range []bool{false, true} {
+			var l0, r0, l1, r1, mask, pad [blockSize]byte
+			rng.Read(l0[:])
+			rng.Read(r0[:])
+			rng.Read(mask[:])
+			rng.Read(pad[:])
+			l1, r1 = l0, r0
+
+			j, step := uint(0), 1
+			if d {
+				j, step = v.rounds-1, -1
+			}
+			e.aezTinyRoundsSlow(&l0, &r0, &mask, &pad, v.i, j, step, v.rounds)
+			e.aezTinyRounds(&l1, &r1, &mask, &pad, v.i, j, step, v.rounds)
+			assertEqual(t, int(v.rounds), l0[:], l1[:])
+			assertEqual(t, int(v.rounds), r0[:], r1[:])
+		}
+	}
+}
+
+func TestBitslicedBatching(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	rng := mrand.New(mrand.NewSource(0))
+	var J, delta, expected, actual [blockSize]byte
+	rng.Read(J[:])
+	rng.Read(delta[:])
+	in := make([]byte, 40*blockSize)
+	rng.Read(in)
+
+	for _, v := range []struct {
+		name string
+		ctor aesImplCtor
+	}{
+		{"ct32", newRoundB32},
+		{"ct64", newRoundB64},
+	} {
+		var e eState
+		e.init(key[:])
+		e.aes.Reset()
+		e.aes = v.ctor(&key)
+
+		// The batched AEZ-hash must match hashing one block at a time.
+		for n := 0; n <= len(in); n += blockSize {
+			copy(expected[:], delta[:])
+			copy(actual[:], delta[:])
+			e.aezHashBlocksRef(&J, in[:n], &expected)
+			e.aezHashBlocksSlow(&J, in[:n], &actual)
+			assertEqual(t, n, expected[:], actual[:])
+		}
+
+		// The batched AEZ-prf must match one counter block at a time.
+		for tau := 1; tau <= 200; tau++ {
+			x, y := make([]byte, tau), make([]byte, tau)
+			e.aezPRFRef(&delta, tau, x)
+			e.aezPRFSlow(&delta, tau, y)
+			assertEqual(t, tau, x, y)
+		}
+
+		// The batched AEZ-core passes must match one pair of blocks at a
+		// time, including the tail after the last full batch.
+		for sz := 0; sz <= len(in); sz += 2 * blockSize {
+			var x0, x1, y0, y1, S [blockSize]byte
+			rng.Read(S[:])
+			out0, out1 := make([]byte, sz), make([]byte, sz)
+			e.aezCorePass1Ref(in, out0, &x0, &e.I[1], sz)
+			e.aezCorePass1Slow(in, out1, &x1, &e.I[1], sz)
+			assertEqual(t, sz, out0, out1)
+			assertEqual(t, sz, x0[:], x1[:])
+
+			e.aezCorePass2Ref(out0, &y0, &S, &e.I[1], sz)
+			e.aezCorePass2Slow(in, out1, &y1, &S, &e.I[1], sz)
+			assertEqual(t, sz, out0, out1)
+			assertEqual(t, sz, y0[:], y1[:])
+		}
+
+		// The batched AES rounds must match one block at a time.
+		for n := 0; n <= 9*blockSize; n += blockSize {
+			x, y := append([]byte{}, in[:n]...), append([]byte{}, in[:n]...)
+			e.aes4BlocksRef(x)
+			e.aes4BlocksSlow(y)
+			assertEqual(t, n, x, y)
+
+			e.aes10BlocksRef(x)
+			e.aes10BlocksSlow(y)
+			assertEqual(t, n, x, y)
+		}
+
+		e.reset()
+	}
+}
+
 // (K, delta, tau, R) ==> AEZ-prf(K, T, tau*8) = R where delta = AEZ-hash(K,T)
 type PrfVector struct {
 	K     string `json:"k"`
@@ -183,8 +358,6 @@ func TestEncryptDecrypt(t *testing.T) {
 }
 
 func assertEncrypt(t *testing.T, vectors []EncryptVector) {
-	var e eState
-
 	for i, vec := range vectors {
 		vecK, err := hex.DecodeString(vec.K)
 		if err != nil {
@@ -212,24 +385,40 @@ func assertEncrypt(t *testing.T, vectors []EncryptVector) {
 		}
 
 		// Test the cipher.AEAD code as well, for applicable test vectors.
-		var aead cipher.AEAD
+		var aead VectorAEAD
 		var ad []byte
-		if len(vecNonce) == aeadNonceSize && vec.Tau == aeadOverhead && len(vecData) <= 1 {
-			aead, err = New(vecK)
+		if vec.Tau > 0 {
+			var a cipher.AEAD
+			if len(vecNonce) == aeadNonceSize && vec.Tau == aeadOverhead {
+				a, err = New(vecK)
+			} else {
+				a, err = NewWithParams(vecK, len(vecNonce), vec.Tau)
+			}
 			if err != nil {
 				t.Fatal(err)
 			}
+			aead = a.(VectorAEAD)
 			if len(vecData) == 1 {
 				ad = vecData[0]
 			}
 		}
 
-		e.init(vecK)
+		ciph, err := NewCipher(vecK)
+		if err != nil {
+			t.Fatal(err)
+		}
+
 		c := Encrypt(vecK, vecNonce, vecData, vec.Tau, vecM, nil)
 		assertEqual(t, i, vecC, c)
+		c = ciph.Encrypt(vecNonce, vecData, vec.Tau, vecM, nil)
+		assertEqual(t, i, vecC, c)
 		if aead != nil {
-			ac := aead.Seal(nil, vecNonce, vecM, ad)
+			ac := aead.SealVector(nil, vecNonce, vecM, vecData)
 			assertEqual(t, i, vecC, ac)
+			if len(vecData) <= 1 {
+				ac = aead.Seal(nil, vecNonce, vecM, ad)
+				assertEqual(t, i, vecC, ac)
+			}
 		}
 
 		m, ok := Decrypt(vecK, vecNonce, vecData, vec.Tau, vecC, nil)
@@ -237,12 +426,483 @@ func assertEncrypt(t *testing.T, vectors []EncryptVector) {
 			t.Fatalf("decrypt failed: [%d]", i)
 		}
 		assertEqual(t, i, vecM, m)
+		m, ok = ciph.Decrypt(vecNonce, vecData, vec.Tau, vecC, nil)
+		if !ok {
+			t.Fatalf("decrypt (Cipher) failed: [%d]", i)
+		}
+		assertEqual(t, i, vecM, m)
 		if aead != nil {
-			am, err := aead.Open(nil, vecNonce, vecC, ad)
+			am, err := aead.OpenVector(nil, vecNonce, vecC, vecData)
 			if err != nil {
 				t.Fatal(err)
 			}
 			assertEqual(t, i, vecM, am)
+			if len(vecData) <= 1 {
+				am, err = aead.Open(nil, vecNonce, vecC, ad)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertEqual(t, i, vecM, am)
+			}
+		}
+		ciph.Reset()
+	}
+}
+
+func TestDecryptUnverified(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	const tau = 16
+
+	var nonce [16]byte
+	for _, sz := range []int{0, 1, 15, 16, 17, 31, 32, 33, 100} {
+		plaintext := make([]byte, sz)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+
+		ct := c.Encrypt(nonce[:], nil, tau, plaintext, nil)
+		m, ok := c.DecryptUnverified(nonce[:], nil, tau, ct, nil)
+		if !ok {
+			t.Fatalf("[%d]: DecryptUnverified failed", sz)
+		}
+		assertEqual(t, sz, plaintext, m)
+		m, ok = DecryptUnverified(key[:], nonce[:], nil, tau, ct, nil)
+		if !ok {
+			t.Fatalf("[%d]: DecryptUnverified (one-shot) failed", sz)
+		}
+		assertEqual(t, sz, plaintext, m)
+
+		// Corrupted ciphertexts must still yield (unverified) plaintext
+		// of the expected length.
+		ct[len(ct)-1] ^= 0x80
+		m, ok = c.DecryptUnverified(nonce[:], nil, tau, ct, nil)
+		if ok {
+			t.Fatalf("[%d]: DecryptUnverified accepted corrupted ciphertext", sz)
+		}
+		if len(m) != sz {
+			t.Fatalf("[%d]: DecryptUnverified returned %d bytes", sz, len(m))
+		}
+		if sz > 0 && bytes.Equal(m, plaintext) {
+			t.Fatalf("[%d]: DecryptUnverified returned the original plaintext", sz)
+		}
+		if _, ok = c.Decrypt(nonce[:], nil, tau, ct, nil); ok {
+			t.Fatalf("[%d]: Decrypt accepted corrupted ciphertext", sz)
+		}
+	}
+
+	if m, ok := c.DecryptUnverified(nonce[:], nil, tau, make([]byte, tau-1), nil); ok || m != nil {
+		t.Fatalf("DecryptUnverified accepted truncated ciphertext")
+	}
+}
+
+func TestEncipherDecipher(t *testing.T) {
+	for _, f := range []string{"encrypt.json", "encrypt_no_ad.json", "encrypt_33_byte_ad.json", "encrypt_16_byte_key.json"} {
+		var encryptVectors []EncryptVector
+		readJsonTestdata(t, f, &encryptVectors)
+
+		for i, vec := range encryptVectors {
+			if vec.Tau != 0 {
+				continue
+			}
+
+			vecK, err := hex.DecodeString(vec.K)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vecNonce, err := hex.DecodeString(vec.Nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tweak := [][]byte{vecNonce}
+			for _, s := range vec.Data {
+				d, err := hex.DecodeString(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tweak = append(tweak, d)
+			}
+			vecM, err := hex.DecodeString(vec.M)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vecC, err := hex.DecodeString(vec.C)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := NewCipher(vecK)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := make([]byte, len(vecM))
+			Encipher(vecK, tweak, vecM, out)
+			assertEqual(t, i, vecC, out)
+			Decipher(vecK, tweak, vecC, out)
+			assertEqual(t, i, vecM, out)
+
+			// In-place.
+			copy(out, vecM)
+			c.Encipher(tweak, out, out)
+			assertEqual(t, i, vecC, out)
+			c.Decipher(tweak, out, out)
+			assertEqual(t, i, vecM, out)
+
+			c.Reset()
+		}
+	}
+}
+
+func TestNewWithParams(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWithParams(nil, aeadNonceSize, aeadOverhead); err == nil {
+		t.Fatalf("NewWithParams: accepted empty key")
+	}
+	if _, err := NewWithParams(key[:], -1, aeadOverhead); err == nil {
+		t.Fatalf("NewWithParams: accepted negative nonce size")
+	}
+	for _, tagSize := range []int{-1, 0, maxTagSize + 1} {
+		if _, err := NewWithParams(key[:], aeadNonceSize, tagSize); err == nil {
+			t.Fatalf("NewWithParams: accepted tag size: %d", tagSize)
+		}
+	}
+
+	plaintext := []byte("This is a test of the emergency broadcast system.")
+	ad := []byte("additional data")
+	for _, nonceSize := range []int{0, 1, 12, 16, 24, 32} {
+		for _, tagSize := range []int{1, 4, 16, 32, 64} {
+			aead, err := NewWithParams(key[:], nonceSize, tagSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if aead.NonceSize() != nonceSize {
+				t.Fatalf("NonceSize: %d != %d", aead.NonceSize(), nonceSize)
+			}
+			if aead.Overhead() != tagSize {
+				t.Fatalf("Overhead: %d != %d", aead.Overhead(), tagSize)
+			}
+
+			nonce := make([]byte, nonceSize)
+			if _, err := rand.Read(nonce); err != nil {
+				t.Fatal(err)
+			}
+
+			c := aead.Seal(nil, nonce, plaintext, ad)
+			if len(c) != len(plaintext)+tagSize {
+				t.Fatalf("Seal: unexpected ciphertext length: %d", len(c))
+			}
+			expected := Encrypt(key[:], nonce, [][]byte{ad}, tagSize, plaintext, nil)
+			assertEqual(t, nonceSize, expected, c)
+
+			m, err := aead.Open(nil, nonce, c, ad)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			assertEqual(t, nonceSize, plaintext, m)
+
+			// Forgeries succeed with probability 2^-(8*tagSize), so
+			// only check rejection with tags large enough to not be
+			// flaky.
+			if tagSize < 4 {
+				continue
+			}
+			c[0] ^= 0x01
+			if _, err = aead.Open(nil, nonce, c, ad); err == nil {
+				t.Fatalf("Open: accepted tampered ciphertext")
+			}
+		}
+	}
+}
+
+func TestVectorAEAD(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead := a.(VectorAEAD)
+
+	var nonce [aeadNonceSize]byte
+	plaintext := []byte("vector additional data")
+	ad := [][]byte{[]byte("header"), []byte("channel"), []byte("sequence")}
+
+	c := aead.SealVector(nil, nonce[:], plaintext, ad)
+	m, err := aead.OpenVector(nil, nonce[:], c, ad)
+	if err != nil {
+		t.Fatalf("OpenVector: %v", err)
+	}
+	assertEqual(t, 0, plaintext, m)
+
+	// Each component must be authenticated separately, and not as the
+	// concatenation of all of the components.
+	badAD := [][]byte{[]byte("headerchannel"), []byte("sequence")}
+	if _, err = aead.OpenVector(nil, nonce[:], c, badAD); err == nil {
+		t.Fatalf("OpenVector: accepted concatenated additional data")
+	}
+	if _, err = aead.Open(nil, nonce[:], c, []byte("headerchannelsequence")); err == nil {
+		t.Fatalf("Open: accepted concatenated additional data")
+	}
+}
+
+func TestInPlace(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	var nonce [16]byte
+	for i, sz := range []int{0, 1, 15, 16, 17, 31, 32, 33, 100, 1000} {
+		plaintext := make([]byte, sz)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+
+		// A tau of 100 exercises AEZ-prf for more than one chunk when
+		// checking an in-place tag.
+		for _, tau := range []int{0, 16, 100} {
+			if sz == 0 && tau == 0 {
+				continue
+			}
+			expected := c.Encrypt(nonce[:], nil, tau, plaintext, nil)
+
+			// Exact aliasing, which must not reallocate.
+			buf := make([]byte, sz, sz+tau)
+			copy(buf, plaintext)
+			ct := c.Encrypt(nonce[:], nil, tau, buf, buf[:0])
+			assertEqual(t, i, expected, ct)
+			if &ct[0] != &buf[:1][0] {
+				t.Fatalf("[%d/%d]: Encrypt: reallocated dst", i, tau)
+			}
+			m, ok := c.Decrypt(nonce[:], nil, tau, ct, ct[:0])
+			if !ok {
+				t.Fatalf("[%d/%d]: Decrypt: rejected valid ciphertext", i, tau)
+			}
+			assertEqual(t, i, plaintext, m)
+
+			// Inexact overlap, with the output offset from the input.
+			buf = make([]byte, 3+sz+tau)
+			copy(buf[3:], plaintext)
+			ct = c.Encrypt(nonce[:], nil, tau, buf[3:3+sz], buf[:0])
+			assertEqual(t, i, expected, ct)
+			copy(buf[3:], ct)
+			m, ok = c.Decrypt(nonce[:], nil, tau, buf[3:], buf[:0])
+			if !ok {
+				t.Fatalf("[%d/%d]: Decrypt: rejected valid offset ciphertext", i, tau)
+			}
+			assertEqual(t, i, plaintext, m)
+
+			// Tampered ciphertexts are still rejected.
+			if tau > 0 {
+				ct = append([]byte{}, expected...)
+				ct[len(ct)-1] ^= 0x01
+				if _, ok = c.Decrypt(nonce[:], nil, tau, ct, ct[:0]); ok {
+					t.Fatalf("[%d/%d]: Decrypt: accepted tampered ciphertext", i, tau)
+				}
+			}
+		}
+	}
+
+	// cipher.AEAD style in-place operation.
+	a, err := New(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("This is a test of the emergency broadcast system.")
+	buf := make([]byte, len(plaintext), len(plaintext)+a.Overhead())
+	copy(buf, plaintext)
+	ct := a.Seal(buf[:0], nonce[:aeadNonceSize], buf, nil)
+	assertEqual(t, 0, a.Seal(nil, nonce[:aeadNonceSize], plaintext, nil), ct)
+	m, err := a.Open(ct[:0], nonce[:aeadNonceSize], ct, nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	assertEqual(t, 0, plaintext, m)
+}
+
+func TestAllocations(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	a, err := New(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := NewCommitting(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.(*CommittingAEAD).Reset()
+
+	const tau = 16
+
+	var nonce [aeadNonceSize]byte
+	ad := []byte("additional data")
+	adVec := [][]byte{ad}
+	for _, sz := range []int{0, 1, 31, 32, 1024} {
+		plaintext := make([]byte, sz)
+		ct := make([]byte, 0, sz+CommitmentSize+tau)
+		m := make([]byte, 0, sz)
+
+		if n := testing.AllocsPerRun(10, func() {
+			ct = c.Encrypt(nonce[:], adVec, tau, plaintext, ct[:0])
+			m, _ = c.Decrypt(nonce[:], adVec, tau, ct, m[:0])
+		}); n != 0 {
+			t.Errorf("[%d]: Cipher: %v allocations", sz, n)
+		}
+
+		if n := testing.AllocsPerRun(10, func() {
+			ct = a.Seal(ct[:0], nonce[:], plaintext, ad)
+			m, _ = a.Open(m[:0], nonce[:], ct, ad)
+		}); n != 0 {
+			t.Errorf("[%d]: AEAD: %v allocations", sz, n)
+		}
+
+		if n := testing.AllocsPerRun(10, func() {
+			ct = ca.Seal(ct[:0], nonce[:], plaintext, ad)
+			m, _ = ca.Open(m[:0], nonce[:], ct, ad)
+		}); n != 0 {
+			t.Errorf("[%d]: CommittingAEAD: %v allocations", sz, n)
+		}
+	}
+
+	// Checking an AEZ-prf tag writes nothing, so it needs no space in dst.
+	ct := c.Encrypt(nonce[:], adVec, tau, nil, nil)
+	if n := testing.AllocsPerRun(10, func() {
+		c.Decrypt(nonce[:], adVec, tau, ct, nil)
+	}); n != 0 {
+		t.Errorf("AEZ-prf: %v allocations", n)
+	}
+}
+
+func TestDecryptWipe(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	a, err := New(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nonce [aeadNonceSize]byte
+	ad := []byte("additional data")
+	adVec := [][]byte{ad}
+	h := c.NewADHasher()
+	h.BeginComponent()
+	h.Write(ad)
+	h.EndComponent()
+	prefix := c.PrecomputeAD(ad)
+	defer prefix.Reset()
+
+	decrypters := []struct {
+		name string
+		fn   func(tau int, ct, dst []byte) ([]byte, bool)
+	}{
+		{"Decrypt", func(tau int, ct, dst []byte) ([]byte, bool) {
+			return Decrypt(key[:], nonce[:], adVec, tau, ct, dst)
+		}},
+		{"Cipher.Decrypt", func(tau int, ct, dst []byte) ([]byte, bool) {
+			return c.Decrypt(nonce[:], adVec, tau, ct, dst)
+		}},
+		{"DecryptWithHasher", func(tau int, ct, dst []byte) ([]byte, bool) {
+			return c.DecryptWithHasher(nonce[:], h, tau, ct, dst)
+		}},
+		{"DecryptWithPrefix", func(tau int, ct, dst []byte) ([]byte, bool) {
+			return c.DecryptWithPrefix(nonce[:], prefix, nil, tau, ct, dst)
+		}},
+		{"DecryptParallel", func(tau int, ct, dst []byte) ([]byte, bool) {
+			return c.DecryptParallel(nonce[:], adVec, tau, ct, dst, 2)
+		}},
+		{"AeadAEZ.Open", func(tau int, ct, dst []byte) ([]byte, bool) {
+			dst, err := a.Open(dst, nonce[:], ct, ad)
+			return dst, err == nil
+		}},
+	}
+
+	// The tags are long enough that a forgery is never accepted by chance,
+	// and any plaintext left behind would be non-zero with overwhelming
+	// probability.
+	for i, sz := range []int{0, 1, 15, 16, 17, 31, 32, 33, 100, 1000, 2*minSegmentSize + 100} {
+		plaintext := make([]byte, sz)
+		for _, tau := range []int{aeadOverhead, 33, 100} {
+			ct := c.Encrypt(nonce[:], adVec, tau, plaintext, nil)
+			ct[len(ct)-1] ^= 0x01
+
+			for _, d := range decrypters {
+				if d.name == "AeadAEZ.Open" && tau != aeadOverhead {
+					continue
+				}
+
+				// Appending to a prefix, with excess capacity, which is
+				// wiped, unless only an AEZ-prf tag was checked, in
+				// which case it is left untouched.
+				const dstSz = 5
+				buf := make([]byte, dstSz, dstSz+len(ct)+7)
+				copy(buf, "prefx")
+				expected := make([]byte, cap(buf))
+				copy(expected, buf)
+				if sz == 0 {
+					for j := dstSz; j < cap(buf); j++ {
+						buf[:cap(buf)][j] = 0xaa
+						expected[j] = 0xaa
+					}
+				}
+				if m, ok := d.fn(tau, ct, buf); ok || m != nil {
+					t.Fatalf("[%d/%d]: %s: accepted forged ciphertext", i, tau, d.name)
+				}
+				assertEqual(t, i, expected, buf[:cap(buf)])
+
+				// In-place, where the ciphertext is also wiped.
+				buf = append([]byte{}, ct...)
+				if m, ok := d.fn(tau, buf, buf[:0]); ok || m != nil {
+					t.Fatalf("[%d/%d]: %s: accepted forged ciphertext in-place", i, tau, d.name)
+				}
+				if sz > 0 {
+					assertEqual(t, i, make([]byte, len(buf)), buf)
+				} else {
+					assertEqual(t, i, ct, buf)
+				}
+			}
 		}
 	}
 }
@@ -296,6 +956,35 @@ func doBenchEncrypt(b *testing.B, n int) {
 	benchOutput = src
 }
 
+func doBenchCipherEncrypt(b *testing.B, n int) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		b.Error(err)
+		b.Fail()
+	}
+
+	const tau = 16
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Reset()
+
+	var nonce [16]byte
+	src := make([]byte, n)
+	dst := make([]byte, n+tau)
+
+	b.SetBytes(int64(n))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst = c.Encrypt(nonce[:], nil, tau, src[:n], dst[:0])
+		copy(src, dst[:n])
+	}
+
+	benchOutput = src
+}
+
 func BenchmarkEncrypt(b *testing.B) {
 	sizes := []int{1, 32, 512, 1024, 2048, 16384, 32768, 65536, 1024768}
 	if testing.Short() {
@@ -309,3 +998,95 @@ func BenchmarkEncrypt(b *testing.B) {
 		b.Run(n, func(b *testing.B) { doBenchEncrypt(b, sz) })
 	}
 }
+
+func BenchmarkCipherEncrypt(b *testing.B) {
+	sizes := []int{1, 32, 512, 1024, 16384, 65536}
+
+	for _, sz := range sizes {
+		n := fmt.Sprintf("%d", sz)
+		b.Run(n, func(b *testing.B) { doBenchCipherEncrypt(b, sz) })
+	}
+}
+
+func BenchmarkEncryptUnaligned(b *testing.B) {
+	sizes := []int{80, 200, 1000}
+
+	for _, sz := range sizes {
+		n := fmt.Sprintf("%d", sz)
+		b.Run(n, func(b *testing.B) { doBenchCipherEncrypt(b, sz) })
+	}
+}
+
+func BenchmarkEncryptSmall(b *testing.B) {
+	sizes := []int{1, 2, 4, 8, 15, 16, 24, 31, 32}
+
+	for _, sz := range sizes {
+		n := fmt.Sprintf("%d", sz)
+		b.Run(n, func(b *testing.B) { doBenchCipherEncrypt(b, sz) })
+	}
+}
+
+func doBenchHashComponents(b *testing.B, n int) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		b.Fatal(err)
+	}
+
+	var e eState
+	defer e.reset()
+	e.init(key[:])
+
+	var nonce, result [blockSize]byte
+	ad := make([][]byte, n)
+	for i := range ad {
+		ad[i] = make([]byte, 8)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.aezHash(nonce[:], ad, 128, result[:])
+	}
+}
+
+func BenchmarkHashComponents(b *testing.B) {
+	counts := []int{1, 8, 64, 512}
+
+	for _, n := range counts {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) { doBenchHashComponents(b, n) })
+	}
+}
+
+func doBenchHashPRF(b *testing.B, n int, prf bool) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		b.Fatal(err)
+	}
+
+	var e eState
+	defer e.reset()
+	e.init(key[:])
+
+	var nonce, delta [blockSize]byte
+	ad := [][]byte{make([]byte, n)}
+	result := make([]byte, n)
+
+	b.SetBytes(int64(n))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if prf {
+			e.aezPRF(&delta, n, result)
+		} else {
+			e.aezHash(nonce[:], ad, 128, delta[:])
+		}
+	}
+}
+
+func BenchmarkHashPRF(b *testing.B) {
+	sizes := []int{16, 64, 512, 4096}
+
+	for _, sz := range sizes {
+		n := fmt.Sprintf("%d", sz)
+		b.Run("Hash/"+n, func(b *testing.B) { doBenchHashPRF(b, sz, false) })
+		b.Run("PRF/"+n, func(b *testing.B) { doBenchHashPRF(b, sz, true) })
+	}
+}
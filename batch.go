@@ -0,0 +1,622 @@
+// batch.go - Batched processing of independent messages.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import "encoding/binary"
+
+const (
+	// batchBlocks is the number of AES4 or AES10 calls that a batchQueue
+	// will accumulate before processing them.
+	batchBlocks = 64
+
+	// maxBatchHashBlocks is the number of full blocks in a nonce or
+	// additional data element above which the element is hashed directly
+	// rather than being interleaved with the other messages.
+	maxBatchHashBlocks = 8
+
+	// maxBatchCoreSize is the message size above which AEZ-core is applied
+	// to the message directly rather than being interleaved with the other
+	// messages, as the AEZ-core passes are already able to process several
+	// blocks of a large message at once.  See eState.batchCoreSize.
+	maxBatchCoreSize = 2048
+)
+
+// Message is a single message to be processed as part of a batch by
+// Cipher.SealBatch or Cipher.OpenBatch.
+type Message struct {
+	// Nonce is the nonce.
+	Nonce []byte
+
+	// AdditionalData is the additional data vector.
+	AdditionalData [][]byte
+
+	// Tau is the length of the authentication tag in bytes.
+	Tau int
+
+	// Input is the plaintext for SealBatch, and the ciphertext for
+	// OpenBatch.  It MUST NOT overlap with the Output of any message.
+	Input []byte
+
+	// Output is the slice that the result is appended to, and is updated
+	// to the resulting slice, or nil if OpenBatch fails.  The Output of
+	// each message in a batch MUST NOT overlap.
+	Output []byte
+
+	// OK is set if the message was processed successfully, which for
+	// OpenBatch indicates that the message was authentic.
+	OK bool
+}
+
+// batchJob is the destination of the result of a queued AES4 or AES10
+// call, as an offset and length into the arena of a batchQueue, optionally
+// also XORed into the following block (dual).
+type batchJob struct {
+	off  int
+	n    int
+	dual bool
+}
+
+// batchQueue accumulates independent AES4 and AES10 calls, potentially from
+// many different messages, so that they can be processed several blocks at
+// a time.  The result of each call is XORed into its destination in the
+// arena when the queue is flushed, so the input of a call MUST NOT be the
+// destination of another call queued since the last explicit flush.
+type batchQueue struct {
+	buf4   [batchBlocks * blockSize]byte
+	buf10  [batchBlocks * blockSize]byte
+	jobs4  [batchBlocks]batchJob
+	jobs10 [batchBlocks]batchJob
+	n4     int
+	n10    int
+
+	arena []byte
+	e     *eState
+}
+
+func (q *batchQueue) aes4(j, i, l *[blockSize]byte, src []byte, off int, dual bool) {
+	if q.n4 == batchBlocks {
+		q.flush4()
+	}
+	xorBytes4x16(j[:], i[:], l[:], src, q.buf4[q.n4*blockSize:])
+	q.jobs4[q.n4] = batchJob{off, blockSize, dual}
+	q.n4++
+}
+
+func (q *batchQueue) aes10(l *[blockSize]byte, src []byte, off, n int) {
+	if q.n10 == batchBlocks {
+		q.flush10()
+	}
+	xorBytes1x16(l[:], src, q.buf10[q.n10*blockSize:])
+	q.jobs10[q.n10] = batchJob{off, n, false}
+	q.n10++
+}
+
+func (q *batchQueue) flush4() {
+	q.e.aes4Blocks(q.buf4[:q.n4*blockSize])
+	q.results(q.buf4[:], q.jobs4[:q.n4])
+	q.n4 = 0
+}
+
+func (q *batchQueue) flush10() {
+	q.e.aes10Blocks(q.buf10[:q.n10*blockSize])
+	q.results(q.buf10[:], q.jobs10[:q.n10])
+	q.n10 = 0
+}
+
+func (q *batchQueue) flush() {
+	q.flush4()
+	q.flush10()
+}
+
+func (q *batchQueue) results(buf []byte, jobs []batchJob) {
+	for k, job := range jobs {
+		b := buf[k*blockSize:]
+		dst := q.arena[job.off : job.off+job.n]
+		if job.n == blockSize {
+			xorBytes1x16(dst, b, dst)
+		} else {
+			xorBytes(dst, b, dst) // non-16 byte xorBytes()
+		}
+		if job.dual {
+			dst = q.arena[job.off+blockSize:]
+			xorBytes1x16(dst, b, dst)
+		}
+	}
+}
+
+func (q *batchQueue) reset() {
+	memwipe(q.buf4[:])
+	memwipe(q.buf10[:])
+	memwipe(q.arena)
+}
+
+// aes4BlocksSlow applies the AES4 rounds in place to each of the independent
+// blocks of buf, which have already been XORed with their J ^ I ^ L tweaks.
+func (e *eState) aes4BlocksSlow(buf []byte) {
+	// NB: The hardware accelerated case is handled prior to this function.
+
+	// Use one of the portable bitsliced options if possible.
+	switch a := e.aes.(type) {
+	case *roundB32:
+		a.aes4Blocks(buf)
+	case *roundB64:
+		a.aes4Blocks(buf)
+	default:
+		e.aes4BlocksRef(buf)
+	}
+}
+
+func (e *eState) aes4BlocksRef(buf []byte) {
+	var tmp [blockSize]byte
+
+	for ; len(buf) >= blockSize; buf = buf[blockSize:] {
+		e.aes4(&zero, &zero, &zero, buf, &tmp)
+		copy(buf, tmp[:])
+	}
+
+	memwipe(tmp[:])
+}
+
+// aes10BlocksSlow applies the AES10 rounds in place to each of the
+// independent blocks of buf, which have already been XORed with their L
+// tweaks.
+func (e *eState) aes10BlocksSlow(buf []byte) {
+	// NB: The hardware accelerated case is handled prior to this function.
+
+	// Use one of the portable bitsliced options if possible.
+	switch a := e.aes.(type) {
+	case *roundB32:
+		a.aes10Blocks(buf)
+	case *roundB64:
+		a.aes10Blocks(buf)
+	default:
+		e.aes10BlocksRef(buf)
+	}
+}
+
+func (e *eState) aes10BlocksRef(buf []byte) {
+	var tmp [blockSize]byte
+
+	for ; len(buf) >= blockSize; buf = buf[blockSize:] {
+		e.aes10(&zero, buf, &tmp)
+		copy(buf, tmp[:])
+	}
+
+	memwipe(tmp[:])
+}
+
+// aezHashBatch queues the AEZ-hash of the tau, nonce and additional data
+// vector, to be accumulated into the block at sum in the arena.
+func (e *eState) aezHashBatch(q *batchQueue, nonce []byte, ad [][]byte, tau int, sum int) {
+	var buf, J [blockSize]byte
+
+	// Hash of tau
+	binary.BigEndian.PutUint32(buf[12:], uint32(tau))
+	xorBytes1x16(e.J[0][:], e.J[1][:], J[:])         // J ^ J2
+	q.aes4(&J, &e.I[1], &e.L[1], buf[:], sum, false) // E(3,1)
+
+	// Hash of the nonce
+	e.aezHashBatchElement(q, &e.J[2], nonce, sum) // E(4,i)
+
+	// Hash of each vector element
+	for k, p := range ad {
+		if x := 5 + uint(k); k == 0 {
+			multBlock(x, &e.J[0], &J)
+		} else {
+			e.nextJ(x-1, &J)
+		}
+		e.aezHashBatchElement(q, &J, p, sum) // E(5+k,i)
+	}
+
+	memwipe(buf[:])
+	memwipe(J[:])
+}
+
+func (e *eState) aezHashBatchElement(q *batchQueue, J *[blockSize]byte, p []byte, sum int) {
+	var buf, I [blockSize]byte
+
+	empty := len(p) == 0
+	bytes := uint(len(p)) % blockSize
+	full := p[:uint(len(p))-bytes]
+	if len(full) > maxBatchHashBlocks*blockSize {
+		e.aezHashBlocks(J, full, &buf)
+		xorBytes1x16(q.arena[sum:], buf[:], q.arena[sum:])
+	} else {
+		copy(I[:], e.I[1][:])
+		for i := uint(1); len(full) > 0; i++ {
+			q.aes4(J, &I, &e.L[i%8], full, sum, false) // E(J,i)
+			full = full[blockSize:]
+			if i%8 == 0 {
+				doubleBlock(&I)
+			}
+		}
+	}
+	if bytes > 0 || empty {
+		oneZeroPad(p[uint(len(p))-bytes:], int(bytes), &buf)
+		q.aes4(J, &e.I[0], &e.L[0], buf[:], sum, false) // E(J,0)
+	}
+
+	memwipe(buf[:])
+	memwipe(I[:])
+}
+
+// aezPRFBatch queues the AEZ-prf of delta, to be XORed into the n bytes at
+// off in the arena.
+func (e *eState) aezPRFBatch(q *batchQueue, delta []byte, off, n int) {
+	var buf, ctr [blockSize]byte
+
+	for ; n > 0; off, n = off+blockSize, n-blockSize {
+		xorBytes1x16(delta, ctr[:], buf[:])
+		if n < blockSize {
+			q.aes10(&e.L[3], buf[:], off, n) // E(-1,3)
+			break
+		}
+		q.aes10(&e.L[3], buf[:], off, blockSize) // E(-1,3)
+		incrementCounter(&ctr)
+	}
+
+	memwipe(buf[:])
+	memwipe(ctr[:])
+}
+
+const (
+	// The per-message state of a batch in the arena, optionally followed by
+	// the message being processed.
+	batchDelta     = 0
+	batchX         = blockSize
+	batchY         = 2 * blockSize
+	batchS         = 3 * blockSize
+	batchStateSize = 4 * blockSize
+)
+
+type batchMode int
+
+const (
+	batchSkip batchMode = iota
+	batchPRF
+	batchCore
+	batchDirect
+)
+
+// batchState is the per-message book keeping of a batch.
+type batchState struct {
+	off  int // Offset of the state in the arena.
+	xOff int // Offset of the message in the arena.
+	xSz  int
+	mode batchMode
+}
+
+// aezCoreBatch applies AEZ-core in place to each message in the arena that
+// is part of the AEZ-core batch, interleaving the steps of all of the
+// messages such that the independent AES calls of each step can be processed
+// together.
+func (e *eState) aezCoreBatch(q *batchQueue, states []batchState, d uint) {
+	var tmp, I [blockSize]byte
+	a := q.arena
+
+	// Pass 1 (first half), the X contribution of the fragment, and the
+	// first half of S.
+	for k := range states {
+		s := &states[k]
+		if s.mode != batchCore {
+			continue
+		}
+		initialBytes, frag, last := coreOffsets(s)
+
+		copy(I[:], e.I[1][:])
+		for i, o := uint(1), s.xOff; o < s.xOff+initialBytes; i, o = i+1, o+32 {
+			q.aes4(&e.J[0], &I, &e.L[i%8], a[o+blockSize:], o, false) // E(1,i)
+			if i%8 == 0 {
+				doubleBlock(&I)
+			}
+		}
+
+		e.aezCoreFragBatch(q, a[frag:last], s.off+batchX, &tmp)
+
+		q.aes4(&zero, &e.I[1], &e.L[(1+d)%8], a[last+blockSize:], last, false) // E(0,1+d)
+	}
+	q.flush()
+
+	// Pass 1 (second half).
+	for k := range states {
+		s := &states[k]
+		if s.mode != batchCore {
+			continue
+		}
+		initialBytes, _, _ := coreOffsets(s)
+
+		for o := s.xOff; o < s.xOff+initialBytes; o += 32 {
+			q.aes4(&zero, &e.I[0], &e.L[0], a[o:], o+blockSize, false) // E(0,0)
+		}
+	}
+	q.flush()
+
+	// Finish X, and the second half of S.
+	for k := range states {
+		s := &states[k]
+		if s.mode != batchCore {
+			continue
+		}
+		initialBytes, _, last := coreOffsets(s)
+
+		X := a[s.off+batchX:]
+		for o := s.xOff; o < s.xOff+initialBytes; o += 32 {
+			xorBytes1x16(a[o+blockSize:], X, X)
+		}
+		xorBytes4x16(a[last:], X, a[s.off+batchDelta:], zero[:], a[last:])
+
+		q.aes10(&e.L[(1+d)%8], a[last:], last+blockSize, blockSize) // E(-1,1+d)
+	}
+	q.flush()
+
+	// Pass 2 (first third), and the enciphering of the fragment.
+	for k := range states {
+		s := &states[k]
+		if s.mode != batchCore {
+			continue
+		}
+		initialBytes, frag, last := coreOffsets(s)
+
+		S := a[s.off+batchS:]
+		xorBytes1x16(a[last:], a[last+blockSize:], S)
+
+		copy(I[:], e.I[1][:])
+		for i, o := uint(1), s.xOff; o < s.xOff+initialBytes; i, o = i+1, o+32 {
+			q.aes4(&e.J[1], &I, &e.L[i%8], S, o, true) // E(2,i)
+			if i%8 == 0 {
+				doubleBlock(&I)
+			}
+		}
+
+		if fragBytes := last - frag; fragBytes >= blockSize {
+			q.aes10(&e.L[4], S, frag, blockSize) // E(-1,4)
+			if fragBytes > blockSize {
+				q.aes10(&e.L[5], S, frag+blockSize, fragBytes-blockSize) // E(-1,5)
+			}
+		} else if fragBytes > 0 {
+			q.aes10(&e.L[4], S, frag, fragBytes) // E(-1,4)
+		}
+	}
+	q.flush()
+
+	// Pass 2 (second third), the Y contribution of the fragment, and the
+	// first half of the final blocks.
+	for k := range states {
+		s := &states[k]
+		if s.mode != batchCore {
+			continue
+		}
+		initialBytes, frag, last := coreOffsets(s)
+
+		Y := a[s.off+batchY:]
+		for o := s.xOff; o < s.xOff+initialBytes; o += 32 {
+			xorBytes1x16(a[o:], Y, Y)
+			q.aes4(&zero, &e.I[0], &e.L[0], a[o+blockSize:], o, false) // E(0,0)
+		}
+
+		e.aezCoreFragBatch(q, a[frag:last], s.off+batchY, &tmp)
+
+		q.aes10(&e.L[(2-d)%8], a[last+blockSize:], last, blockSize) // E(-1,2-d)
+	}
+	q.flush()
+
+	// Pass 2 (final third), and the second half of the final blocks.
+	for k := range states {
+		s := &states[k]
+		if s.mode != batchCore {
+			continue
+		}
+		initialBytes, _, last := coreOffsets(s)
+
+		copy(I[:], e.I[1][:])
+		for i, o := uint(1), s.xOff; o < s.xOff+initialBytes; i, o = i+1, o+32 {
+			q.aes4(&e.J[0], &I, &e.L[i%8], a[o:], o+blockSize, false) // E(1,i)
+			if i%8 == 0 {
+				doubleBlock(&I)
+			}
+		}
+
+		q.aes4(&zero, &e.I[1], &e.L[(2-d)%8], a[last:], last+blockSize, false) // E(0,2-d)
+	}
+	q.flush()
+
+	// Finish the final blocks, and swap the halves of each pair.
+	for k := range states {
+		s := &states[k]
+		if s.mode != batchCore {
+			continue
+		}
+		initialBytes, _, last := coreOffsets(s)
+
+		for o := s.xOff; o < s.xOff+initialBytes; o += 32 {
+			swapBlocks(&tmp, a[o:])
+		}
+		xorBytes4x16(a[last+blockSize:], a[s.off+batchDelta:], a[s.off+batchY:], zero[:], a[last+blockSize:])
+		swapBlocks(&tmp, a[last:])
+	}
+
+	memwipe(tmp[:])
+	memwipe(I[:])
+}
+
+// aezCoreFragBatch queues the contribution of the AEZ-core fragment to X or
+// Y, to be accumulated into the block at sum in the arena.
+func (e *eState) aezCoreFragBatch(q *batchQueue, frag []byte, sum int, tmp *[blockSize]byte) {
+	fragBytes := len(frag)
+	if fragBytes >= blockSize {
+		q.aes4(&zero, &e.I[1], &e.L[4], frag, sum, false) // E(0,4)
+		oneZeroPad(frag[blockSize:], fragBytes-blockSize, tmp)
+		q.aes4(&zero, &e.I[1], &e.L[5], tmp[:], sum, false) // E(0,5)
+	} else if fragBytes > 0 {
+		oneZeroPad(frag, fragBytes, tmp)
+		q.aes4(&zero, &e.I[1], &e.L[4], tmp[:], sum, false) // E(0,4)
+	}
+}
+
+// coreOffsets returns the size of the block pairs processed by the AEZ-core
+// passes, and the offsets of the fragment and the final block pair of the
+// message in the arena.
+func coreOffsets(s *batchState) (int, int, int) {
+	fragBytes := s.xSz % 32
+	initialBytes := s.xSz - fragBytes - 32
+	return initialBytes, s.xOff + initialBytes, s.xOff + s.xSz - 32
+}
+
+func (e *eState) processBatch(msgs []Message, d uint) {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	// Lay out the arena, with the state of each message, followed by the
+	// message itself if it is processed as part of the batch.
+	states := make([]batchState, len(msgs))
+	arenaSz := 0
+	for k := range msgs {
+		m, s := &msgs[k], &states[k]
+
+		s.xSz = len(m.Input)
+		if d == 0 {
+			s.xSz += m.Tau
+		} else if len(m.Input) < m.Tau {
+			continue
+		}
+		switch {
+		case len(m.Input) == 0 || len(m.Input) == m.Tau && d == 1:
+			s.mode = batchPRF
+		case s.xSz < 32 || s.xSz > e.batchCoreSize():
+			s.mode = batchDirect
+		default:
+			s.mode = batchCore
+		}
+
+		s.off = arenaSz
+		arenaSz += batchStateSize
+		if s.mode != batchDirect {
+			s.xOff = arenaSz
+			arenaSz += s.xSz
+		}
+	}
+
+	q := &batchQueue{
+		arena: make([]byte, arenaSz),
+		e:     e,
+	}
+	defer q.reset()
+
+	// Hash each message.
+	for k := range msgs {
+		m, s := &msgs[k], &states[k]
+		if s.mode != batchSkip {
+			e.aezHashBatch(q, m.Nonce, m.AdditionalData, m.Tau*8, s.off+batchDelta)
+		}
+	}
+	q.flush()
+
+	// Process the messages that are not part of the AEZ-core batch, and
+	// copy the rest into the arena.
+	for k := range msgs {
+		m, s := &msgs[k], &states[k]
+		switch s.mode {
+		case batchPRF:
+			e.aezPRFBatch(q, q.arena[s.off+batchDelta:], s.xOff, s.xSz)
+		case batchCore:
+			copy(q.arena[s.xOff:], m.Input)
+		case batchDirect:
+			copy(delta[:], q.arena[s.off+batchDelta:])
+			x := batchOutput(m, s.xSz)
+			memwipe(x[len(m.Input):])
+			copy(x, m.Input)
+			if s.xSz < 32 {
+				e.aezTiny(&delta, x, d, x)
+			} else {
+				e.aezCore(&delta, x, d, x, 1)
+			}
+		}
+	}
+	q.flush()
+
+	e.aezCoreBatch(q, states, d)
+
+	// Copy the output of each message processed as part of the batch, and
+	// authenticate each message if required.
+	for k := range msgs {
+		m, s := &msgs[k], &states[k]
+		if s.mode == batchSkip {
+			m.Output, m.OK = nil, false
+			continue
+		}
+
+		if s.mode == batchPRF && d != 0 {
+			// Compare the tag against the AEZ-prf output in the arena, so
+			// that, as with Decrypt, nothing is written to Output.
+			sum := byte(0)
+			for i, v := range q.arena[s.xOff : s.xOff+s.xSz] {
+				sum |= v ^ m.Input[i]
+			}
+			if sum != 0 {
+				m.Output = nil
+			}
+			m.OK = sum == 0
+			continue
+		}
+
+		var x []byte
+		if s.mode == batchDirect {
+			x = m.Output[len(m.Output)-s.xSz:]
+		} else {
+			x = batchOutput(m, s.xSz)
+			copy(x, q.arena[s.xOff:s.xOff+s.xSz])
+		}
+		if d == 0 {
+			m.OK = true
+			continue
+		}
+
+		sum := byte(0)
+		for i := 0; i < m.Tau; i++ {
+			sum |= x[len(x)-m.Tau+i]
+		}
+		if sum != 0 {
+			memwipe(x)
+			m.Output, m.OK = nil, false
+			continue
+		}
+		m.Output, m.OK = m.Output[:len(m.Output)-m.Tau], true
+	}
+}
+
+// batchOutput appends sz bytes to the Output of the message, and returns the
+// appended bytes.
+func batchOutput(m *Message, sz int) []byte {
+	dstSz := len(m.Output)
+	if cap(m.Output) >= dstSz+sz {
+		m.Output = m.Output[:dstSz+sz]
+	} else {
+		x := make([]byte, dstSz+sz)
+		copy(x, m.Output)
+		m.Output = x
+	}
+	return m.Output[dstSz:]
+}
+
+// SealBatch encrypts and authenticates each of the messages, as if by
+// calling Encrypt on each message's Nonce, AdditionalData, Tau, Input and
+// Output, storing the result in the message's Output.  The processing of
+// the messages is interleaved, so that the independent AES calls of many
+// small messages can be processed together rather than one at a time.
+func (c *Cipher) SealBatch(msgs []Message) {
+	c.e.processBatch(msgs, 0)
+}
+
+// OpenBatch decrypts and authenticates each of the messages, as if by
+// calling Decrypt on each message's Nonce, AdditionalData, Tau, Input and
+// Output, storing the result in the message's Output and OK.  The
+// authenticity of each message is independent of that of the others, and
+// messages that fail to authenticate have their Output set to nil.
+func (c *Cipher) OpenBatch(msgs []Message) {
+	c.e.processBatch(msgs, 1)
+}
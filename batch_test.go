@@ -0,0 +1,224 @@
+// batch_test.go - Batched processing of independent messages tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	mrand "math/rand"
+	"testing"
+)
+
+func TestSealBatch(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	rng := mrand.New(mrand.NewSource(0))
+	randBytes := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+
+	for iter := 0; iter < 20; iter++ {
+		// Random messages, covering AEZ-prf, AEZ-tiny, and both the
+		// batched and unbatched AEZ-core.
+		msgs := make([]Message, rng.Intn(100)+1)
+		expected := make([][]byte, len(msgs))
+		for i := range msgs {
+			m := &msgs[i]
+			m.Nonce = randBytes(rng.Intn(40))
+			m.AdditionalData = make([][]byte, rng.Intn(3))
+			for j := range m.AdditionalData {
+				m.AdditionalData[j] = randBytes(rng.Intn(200))
+			}
+			m.Tau = []int{0, 1, 16, 33}[rng.Intn(4)]
+			switch rng.Intn(4) {
+			case 0:
+				m.Input = randBytes(rng.Intn(32))
+			case 1:
+				m.Input = randBytes(rng.Intn(maxBatchCoreSize + 100))
+			default:
+				m.Input = randBytes(64 + rng.Intn(450))
+			}
+			if m.Tau == 0 && len(m.Input) == 0 {
+				m.Tau = 16
+			}
+			m.Output = randBytes(rng.Intn(4))
+
+			expected[i] = c.Encrypt(m.Nonce, m.AdditionalData, m.Tau, m.Input, append([]byte{}, m.Output...))
+		}
+
+		c.SealBatch(msgs)
+		for i := range msgs {
+			if !msgs[i].OK {
+				t.Fatalf("[%d/%d]: SealBatch: !OK", iter, i)
+			}
+			assertEqual(t, i, expected[i], msgs[i].Output)
+		}
+
+		// Tamper with some of the messages, and open the batch.
+		tampered := make([][]byte, len(msgs))
+		for i := range msgs {
+			m := &msgs[i]
+			pt := m.Input
+			ct := m.Output[len(m.Output)-len(pt)-m.Tau:]
+			m.Input, m.Output = ct, nil
+			if m.Tau >= 16 && rng.Intn(4) == 0 {
+				m.Input[rng.Intn(len(m.Input))] ^= 0x01
+				m.Output = make([]byte, 0, len(m.Input)+3)
+				if len(pt) == 0 {
+					// Checking an AEZ-prf tag writes nothing.
+					copy(m.Output[:cap(m.Output)], bytes.Repeat([]byte{0xaa}, cap(m.Output)))
+				}
+				tampered[i] = m.Output
+			}
+			expected[i] = pt
+		}
+
+		c.OpenBatch(msgs)
+		for i := range msgs {
+			m := &msgs[i]
+			if buf := tampered[i]; buf != nil {
+				if m.OK || m.Output != nil {
+					t.Fatalf("[%d/%d]: OpenBatch: accepted tampered ciphertext", iter, i)
+				}
+				fill := make([]byte, cap(buf))
+				if len(expected[i]) == 0 {
+					fill = bytes.Repeat([]byte{0xaa}, cap(buf))
+				}
+				assertEqual(t, i, fill, buf[:cap(buf)])
+				continue
+			}
+			if !m.OK {
+				t.Fatalf("[%d/%d]: OpenBatch: rejected valid ciphertext", iter, i)
+			}
+			assertEqual(t, i, expected[i], m.Output)
+
+			m2, ok := c.Decrypt(m.Nonce, m.AdditionalData, m.Tau, m.Input, nil)
+			if !ok {
+				t.Fatalf("[%d/%d]: Decrypt: rejected valid ciphertext", iter, i)
+			}
+			assertEqual(t, i, m2, m.Output)
+		}
+	}
+
+	// Truncated ciphertexts are rejected.
+	msgs := []Message{{Tau: 16, Input: make([]byte, 15)}}
+	c.OpenBatch(msgs)
+	if msgs[0].OK || msgs[0].Output != nil {
+		t.Fatalf("OpenBatch: accepted truncated ciphertext")
+	}
+}
+
+func TestAEZCoreBatch(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	var e eState
+	e.init(key[:])
+	defer e.reset()
+
+	// AEZ-core is only batched on some platforms, so compare the batched
+	// AEZ-core against the regular one directly.
+	rng := mrand.New(mrand.NewSource(0))
+	for _, d := range []uint{0, 1} {
+		states := make([]batchState, 50)
+		arenaSz := 0
+		for k := range states {
+			s := &states[k]
+			s.mode = batchCore
+			s.xSz = 32 + rng.Intn(600)
+			s.off = arenaSz
+			s.xOff = arenaSz + batchStateSize
+			arenaSz += batchStateSize + s.xSz
+		}
+		q := &batchQueue{
+			arena: make([]byte, arenaSz),
+			e:     &e,
+		}
+		expected := make([][]byte, len(states))
+		for k := range states {
+			s := &states[k]
+			var delta [blockSize]byte
+			rng.Read(delta[:])
+			copy(q.arena[s.off+batchDelta:], delta[:])
+			rng.Read(q.arena[s.xOff : s.xOff+s.xSz])
+
+			expected[k] = make([]byte, s.xSz)
+			e.aezCore(&delta, q.arena[s.xOff:s.xOff+s.xSz], d, expected[k], 1)
+		}
+
+		e.aezCoreBatch(q, states, d)
+		for k := range states {
+			s := &states[k]
+			assertEqual(t, k, expected[k], q.arena[s.xOff:s.xOff+s.xSz])
+		}
+	}
+}
+
+func doBenchSealBatch(b *testing.B, n, batchSize int, batched bool) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		b.Fatal(err)
+	}
+
+	const tau = 16
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Reset()
+
+	msgs := make([]Message, batchSize)
+	dst := make([][]byte, batchSize)
+	for i := range msgs {
+		msgs[i].Nonce = make([]byte, 16)
+		msgs[i].Tau = tau
+		msgs[i].Input = make([]byte, n)
+		dst[i] = make([]byte, 0, n+tau)
+	}
+
+	b.SetBytes(int64(n * batchSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range msgs {
+			msgs[j].Output = dst[j][:0]
+		}
+		if batched {
+			c.SealBatch(msgs)
+		} else {
+			for j := range msgs {
+				m := &msgs[j]
+				m.Output = c.Encrypt(m.Nonce, m.AdditionalData, m.Tau, m.Input, m.Output)
+			}
+		}
+	}
+}
+
+func BenchmarkSealBatch(b *testing.B) {
+	sizes := []int{1, 64, 128, 256, 512}
+
+	for _, sz := range sizes {
+		n := fmt.Sprintf("%d", sz)
+		b.Run("Encrypt/"+n, func(b *testing.B) { doBenchSealBatch(b, sz, 128, false) })
+		b.Run("SealBatch/"+n, func(b *testing.B) { doBenchSealBatch(b, sz, 128, true) })
+	}
+}
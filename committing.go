@@ -0,0 +1,206 @@
+// committing.go - Key-committing AEAD wrapper.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"hash"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// CommitmentSize is the size of the key commitment prepended to each
+// ciphertext by CommittingAEAD in bytes.
+const CommitmentSize = 32
+
+var commitmentKeyLabel = []byte("AEZ-CommittingAEAD-Key")
+
+// CommittingAEAD is AeadAEZ with a key commitment, such that a ciphertext
+// can only be opened under the key it was sealed with.
+//
+// AEZ, like most AEAD constructions, does not guarantee this property, as it
+// is possible to construct a ciphertext that is valid under multiple keys,
+// which can be used to break multi-tenant envelope encryption, and to build
+// partitioning oracles.
+//
+// Ciphertexts consist of a CommitmentSize byte commitment followed by the
+// AeadAEZ ciphertext, where the commitment is:
+//
+//   commitKey = BLAKE2b-256(key = extractedKey, "AEZ-CommittingAEAD-Key")
+//   commitment = BLAKE2b-256(key = commitKey, nonce)
+//
+// and extractedKey is the output of the AEZ key extraction.  As BLAKE2b is
+// collision resistant, finding a ciphertext that opens under multiple keys
+// requires finding a BLAKE2b collision.  The nonce is included, so that the
+// commitment does not reveal when multiple messages are sealed with the same
+// key (except when the nonce is also reused).
+type CommittingAEAD struct {
+	a         AeadAEZ
+	commitKey [CommitmentSize]byte
+
+	// The keyed BLAKE2b instance is reused, as creating one allocates.
+	mu  sync.Mutex
+	h   hash.Hash
+	sum [CommitmentSize]byte
+}
+
+func (c *CommittingAEAD) commitment(nonce, commitment []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.h.Reset()
+	c.h.Write(nonce)
+	c.h.Sum(c.sum[:0])
+	copy(commitment, c.sum[:])
+	memwipe(c.sum[:])
+}
+
+// NonceSize returns the size of the nonce that must be passed to Seal
+// and Open.
+func (c *CommittingAEAD) NonceSize() int {
+	return c.a.nonceSize
+}
+
+// Overhead returns the maximum difference between the lengths of a
+// plaintext and its ciphertext.
+func (c *CommittingAEAD) Overhead() int {
+	return CommitmentSize + c.a.tagSize
+}
+
+// Reset clears the sensitive keying material from the datastructure such
+// that it will no longer be in memory.
+func (c *CommittingAEAD) Reset() {
+	c.a.Reset()
+	memwipe(c.commitKey[:])
+}
+
+// Seal encrypts and authenticates plaintext, authenticates the
+// additional data and appends the result to dst, returning the updated
+// slice.  The nonce must be NonceSize() bytes long.
+func (c *CommittingAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	// The vector is backed by an array, so that it stays on the stack.
+	var adVec [1][]byte
+	var ad [][]byte
+	if additionalData != nil {
+		adVec[0] = additionalData
+		ad = adVec[:]
+	}
+	return c.SealVector(dst, nonce, plaintext, ad)
+}
+
+// Open verifies the key commitment, decrypts and authenticates ciphertext,
+// authenticates the additional data and, if successful, appends the
+// resulting plaintext to dst, returning the updated slice. The nonce must be
+// NonceSize() bytes long and both it and the additional data must match the
+// value passed to Seal.
+func (c *CommittingAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	// The vector is backed by an array, so that it stays on the stack.
+	var adVec [1][]byte
+	var ad [][]byte
+	if additionalData != nil {
+		adVec[0] = additionalData
+		ad = adVec[:]
+	}
+	return c.OpenVector(dst, nonce, ciphertext, ad)
+}
+
+// SealVector encrypts and authenticates plaintext, authenticates each
+// element of the additional data vector and appends the result to dst,
+// returning the updated slice.  The nonce must be NonceSize() bytes long.
+func (c *CommittingAEAD) SealVector(dst, nonce, plaintext []byte, additionalData [][]byte) []byte {
+	if len(nonce) != c.a.nonceSize {
+		panic("aez: incorrect nonce length given to AEZ")
+	}
+
+	// The ciphertext is offset from the plaintext by the commitment, so
+	// encrypt first, as plaintext may alias the commitment's location.
+	ret, out := sliceForAppend(dst, CommitmentSize+len(plaintext)+c.a.tagSize)
+	c.a.c.e.encrypt(nonce, additionalData, c.a.tagSize, plaintext, out[:CommitmentSize])
+	c.commitment(nonce, out[:CommitmentSize])
+
+	return ret
+}
+
+// OpenVector verifies the key commitment, decrypts and authenticates
+// ciphertext, authenticates each element of the additional data vector and,
+// if successful, appends the resulting plaintext to dst, returning the
+// updated slice.  The nonce must be NonceSize() bytes long and both it and
+// the additional data vector must match the values passed to SealVector.
+func (c *CommittingAEAD) OpenVector(dst, nonce, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	var commitment [CommitmentSize]byte
+
+	if len(nonce) != c.a.nonceSize {
+		panic("aez: incorrect nonce length given to AEZ")
+	}
+	if len(ciphertext) < CommitmentSize {
+		return nil, errOpen
+	}
+
+	c.commitment(nonce, commitment[:])
+	if subtle.ConstantTimeCompare(commitment[:], ciphertext[:CommitmentSize]) != 1 {
+		return nil, errOpen
+	}
+
+	return c.a.OpenVector(dst, nonce, ciphertext[CommitmentSize:], additionalData)
+}
+
+// NewCommitting returns AEZ wrapped in a new key-committing cipher.AEAD
+// instance, with the recommended nonce and tag lengths.  The returned
+// instance also implements VectorAEAD.
+func NewCommitting(key []byte) (cipher.AEAD, error) {
+	return NewCommittingWithParams(key, aeadNonceSize, aeadOverhead)
+}
+
+// NewCommittingWithParams returns AEZ wrapped in a new key-committing
+// cipher.AEAD instance, with the specified nonce and tag lengths in bytes,
+// with the same restrictions as NewWithParams.  The returned instance also
+// implements VectorAEAD.
+func NewCommittingWithParams(key []byte, nonceSize, tagSize int) (cipher.AEAD, error) {
+	var extractedKey [extractedKeySize]byte
+	defer memwipe(extractedKey[:])
+
+	if len(key) == 0 {
+		return nil, errInvalidKeySize
+	}
+	if nonceSize < 0 {
+		return nil, errInvalidNonceSize
+	}
+	if tagSize < 1 || tagSize > maxTagSize {
+		return nil, errInvalidTagSize
+	}
+
+	c := &CommittingAEAD{
+		a: AeadAEZ{
+			nonceSize: nonceSize,
+			tagSize:   tagSize,
+		},
+	}
+
+	// Extract the key once, and use it for both AEZ (which will use an
+	// extractedKeySize key as is) and the commitment.
+	extract(key, &extractedKey)
+	c.a.c.e.init(extractedKey[:])
+
+	h, err := blake2b.New256(extractedKey[:])
+	if err != nil {
+		panic("aez: CommittingAEAD: " + err.Error())
+	}
+	defer h.Reset()
+	h.Write(commitmentKeyLabel)
+	h.Sum(c.commitKey[:0])
+
+	if c.h, err = blake2b.New256(c.commitKey[:]); err != nil {
+		panic("aez: CommittingAEAD: " + err.Error())
+	}
+
+	return c, nil
+}
+
+var _ VectorAEAD = (*CommittingAEAD)(nil)
@@ -0,0 +1,132 @@
+// committing_test.go - Key-committing AEAD wrapper tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestCommittingAEAD(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := NewCommitting(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aead.(*CommittingAEAD).Reset()
+
+	if aead.NonceSize() != aeadNonceSize {
+		t.Fatalf("NonceSize: %d", aead.NonceSize())
+	}
+	if aead.Overhead() != CommitmentSize+aeadOverhead {
+		t.Fatalf("Overhead: %d", aead.Overhead())
+	}
+
+	var nonce [aeadNonceSize]byte
+	if _, err = rand.Read(nonce[:]); err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("This is a test of the emergency broadcast system.")
+	ad := []byte("additional data")
+
+	c := aead.Seal(nil, nonce[:], plaintext, ad)
+	if len(c) != len(plaintext)+aead.Overhead() {
+		t.Fatalf("Seal: unexpected ciphertext length: %d", len(c))
+	}
+	expected := Encrypt(key[:], nonce[:], [][]byte{ad}, aeadOverhead, plaintext, nil)
+	assertEqual(t, 0, expected, c[CommitmentSize:])
+
+	m, err := aead.Open(nil, nonce[:], c, ad)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	assertEqual(t, 0, plaintext, m)
+
+	// In-place operation, where the output is offset from the input by
+	// the commitment.
+	buf := make([]byte, len(plaintext), len(plaintext)+aead.Overhead())
+	copy(buf, plaintext)
+	buf = aead.Seal(buf[:0], nonce[:], buf, ad)
+	assertEqual(t, 0, c, buf)
+	if m, err = aead.Open(buf[:0], nonce[:], buf, ad); err != nil {
+		t.Fatalf("Open: in-place: %v", err)
+	}
+	assertEqual(t, 0, plaintext, m)
+
+	// The commitment depends on the nonce.
+	otherNonce := nonce
+	otherNonce[0] ^= 0x01
+	c2 := aead.Seal(nil, otherNonce[:], plaintext, ad)
+	if bytes.Equal(c[:CommitmentSize], c2[:CommitmentSize]) {
+		t.Fatalf("Seal: commitment does not depend on the nonce")
+	}
+
+	for _, l := range []int{0, CommitmentSize - 1, CommitmentSize} {
+		if _, err = aead.Open(nil, nonce[:], c[:l], ad); err != errOpen {
+			t.Fatalf("Open: accepted truncated ciphertext (%d): %v", l, err)
+		}
+	}
+	c[0] ^= 0x01
+	if _, err = aead.Open(nil, nonce[:], c, ad); err != errOpen {
+		t.Fatalf("Open: accepted tampered commitment: %v", err)
+	}
+}
+
+func TestCommittingAEADMultiKey(t *testing.T) {
+	var key1, key2 [extractedKeySize]byte
+	if _, err := rand.Read(key1[:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(key2[:]); err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aeadNonceSize)
+
+	// With a 1 byte tag, a ciphertext produced under key1 also is valid
+	// under key2 with probability 2^-8, so brute force one.
+	var c []byte
+	for i := 0; ; i++ {
+		if i == 1<<16 {
+			t.Fatalf("failed to find a ciphertext valid under both keys")
+		}
+		c = Encrypt(key1[:], nonce, nil, 1, []byte{byte(i), byte(i >> 8)}, nil)
+		if _, ok := Decrypt(key2[:], nonce, nil, 1, c, nil); ok {
+			break
+		}
+	}
+	if _, ok := Decrypt(key1[:], nonce, nil, 1, c, nil); !ok {
+		t.Fatalf("Decrypt: rejected ciphertext under key1")
+	}
+
+	aead1, err := NewCommittingWithParams(key1[:], aeadNonceSize, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aead1.(*CommittingAEAD).Reset()
+	aead2, err := NewCommittingWithParams(key2[:], aeadNonceSize, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aead2.(*CommittingAEAD).Reset()
+
+	// The committed ciphertext opens under key1, but not key2, despite the
+	// inner ciphertext being valid under both keys.
+	committed := aead1.Seal(nil, nonce, nil, nil)
+	committed = append(committed[:CommitmentSize], c...)
+	if _, err = aead1.Open(nil, nonce, committed, nil); err != nil {
+		t.Fatalf("Open: rejected ciphertext under key1: %v", err)
+	}
+	if _, err = aead2.Open(nil, nonce, committed, nil); err != errOpen {
+		t.Fatalf("Open: accepted ciphertext under key2: %v", err)
+	}
+}
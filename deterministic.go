@@ -0,0 +1,124 @@
+// deterministic.go - Deterministic authenticated encryption and key wrapping.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import "errors"
+
+var errInvalidWrappedKeySize = errors.New("aez: Invalid wrapped key size")
+
+const (
+	// WrapTagSize is the size of the authentication tag appended to keys
+	// by WrapKey in bytes.
+	WrapTagSize = 16
+
+	// MinWrapKeySize is the minimum size of a key that can be wrapped by
+	// WrapKey in bytes.
+	MinWrapKeySize = 16
+
+	// MaxWrapKeySize is the maximum size of a key that can be wrapped by
+	// WrapKey in bytes.
+	MaxWrapKeySize = 4096
+
+	deterministicOverhead = 16
+)
+
+// DeterministicAEAD is AEZ used as a deterministic authenticated encryption
+// (DAE) scheme, by encrypting with an empty nonce and a 16 byte tag.
+//
+// As AEZ is misuse resistant, the only information leaked by a DAE scheme is
+// if the same plaintext was encrypted with the same vector of additional
+// data, in which case the ciphertexts will be identical.  This is exactly
+// the property required for key wrapping and deduplication.  Users that
+// do not need determinism should use a unique nonce via AeadAEZ or Cipher
+// instead, so that repeated messages are not revealed.
+type DeterministicAEAD struct {
+	c Cipher
+}
+
+// Overhead returns the maximum difference between the lengths of a
+// plaintext and its ciphertext.
+func (d *DeterministicAEAD) Overhead() int {
+	return deterministicOverhead
+}
+
+// Reset clears the sensitive keying material from the datastructure such
+// that it will no longer be in memory.
+func (d *DeterministicAEAD) Reset() {
+	d.c.Reset()
+}
+
+// Seal encrypts and authenticates plaintext, authenticates each element of
+// the additional data vector and appends the result to dst, returning the
+// updated slice.  The plaintext and dst slices may overlap, and plaintext[:0]
+// may be used as dst to encrypt in place.
+func (d *DeterministicAEAD) Seal(dst, plaintext []byte, additionalData [][]byte) []byte {
+	return d.c.Encrypt(nil, additionalData, deterministicOverhead, plaintext, dst)
+}
+
+// Open decrypts and authenticates ciphertext, authenticates each element of
+// the additional data vector and, if successful, appends the resulting
+// plaintext to dst, returning the updated slice.  The additional data vector
+// must match the value passed to Seal.  The ciphertext and dst slices may
+// overlap, and ciphertext[:0] may be used as dst to decrypt in place.
+func (d *DeterministicAEAD) Open(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	dst, ok := d.c.Decrypt(nil, additionalData, deterministicOverhead, ciphertext, dst)
+	if !ok {
+		return nil, errOpen
+	}
+	return dst, nil
+}
+
+// NewDeterministic returns a new DeterministicAEAD instance keyed with the
+// provided key.
+func NewDeterministic(key []byte) (*DeterministicAEAD, error) {
+	if len(key) == 0 {
+		return nil, errInvalidKeySize
+	}
+	d := new(DeterministicAEAD)
+	d.c.e.init(key)
+	return d, nil
+}
+
+// WrapKey wraps (encrypts and authenticates) key with the key encryption key
+// kek, returning the wrapped key, which is WrapTagSize bytes longer than the
+// key.  The key MUST be between MinWrapKeySize and MaxWrapKeySize bytes.
+//
+// Wrapping is deterministic, and is equivalent to DeterministicAEAD.Seal
+// with no additional data.
+func WrapKey(kek, key []byte) ([]byte, error) {
+	if len(kek) == 0 || len(key) < MinWrapKeySize || len(key) > MaxWrapKeySize {
+		return nil, errInvalidKeySize
+	}
+
+	var e eState
+	defer e.reset()
+
+	e.init(kek)
+	return e.encrypt(nil, nil, WrapTagSize, key, nil), nil
+}
+
+// UnwrapKey unwraps (decrypts and authenticates) a key wrapped by WrapKey
+// with the key encryption key kek, returning the key.
+func UnwrapKey(kek, wrapped []byte) ([]byte, error) {
+	if len(kek) == 0 {
+		return nil, errInvalidKeySize
+	}
+	if len(wrapped) < MinWrapKeySize+WrapTagSize || len(wrapped) > MaxWrapKeySize+WrapTagSize {
+		return nil, errInvalidWrappedKeySize
+	}
+
+	var e eState
+	defer e.reset()
+
+	e.init(kek)
+	key, ok := e.decrypt(nil, nil, WrapTagSize, wrapped, nil)
+	if !ok {
+		return nil, errOpen
+	}
+	return key, nil
+}
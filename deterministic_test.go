@@ -0,0 +1,141 @@
+// deterministic_test.go - DAE and key wrapping tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// (K, A, M, C) ==> Encrypt(K,"",A,16,M) = C
+type DeterministicVector struct {
+	K    string   `json:"k"`
+	Data []string `json:"data"`
+	M    string   `json:"m"`
+	C    string   `json:"c"`
+}
+
+func TestDeterministicAEAD(t *testing.T) {
+	var vectors []DeterministicVector
+
+	readJsonTestdata(t, "deterministic.json", &vectors)
+
+	for i, vec := range vectors {
+		vecK, err := hex.DecodeString(vec.K)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vecData [][]byte
+		for _, s := range vec.Data {
+			d, err := hex.DecodeString(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vecData = append(vecData, d)
+		}
+		vecM, err := hex.DecodeString(vec.M)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vecC, err := hex.DecodeString(vec.C)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := NewDeterministic(vecK)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := d.Seal(nil, vecM, vecData)
+		assertEqual(t, i, vecC, c)
+		assertEqual(t, i, Encrypt(vecK, nil, vecData, d.Overhead(), vecM, nil), c)
+
+		m, err := d.Open(nil, vecC, vecData)
+		if err != nil {
+			t.Fatalf("[%d]: Open: %v", i, err)
+		}
+		assertEqual(t, i, vecM, m)
+
+		vecC[0] ^= 0x01
+		if _, err = d.Open(nil, vecC, vecData); err == nil {
+			t.Fatalf("[%d]: Open accepted corrupted ciphertext", i)
+		}
+		vecC[0] ^= 0x01
+		if _, err = d.Open(nil, vecC, append(vecData, nil)); err == nil {
+			t.Fatalf("[%d]: Open accepted incorrect additional data", i)
+		}
+
+		d.Reset()
+	}
+
+	if _, err := NewDeterministic(nil); err == nil {
+		t.Fatalf("NewDeterministic: accepted empty key")
+	}
+}
+
+// (KEK, K, W) ==> WrapKey(KEK,K) = W
+type KeyWrapVector struct {
+	KEK     string `json:"kek"`
+	Key     string `json:"key"`
+	Wrapped string `json:"wrapped"`
+}
+
+func TestKeyWrap(t *testing.T) {
+	var vectors []KeyWrapVector
+
+	readJsonTestdata(t, "keywrap.json", &vectors)
+
+	for i, vec := range vectors {
+		vecKEK, err := hex.DecodeString(vec.KEK)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vecKey, err := hex.DecodeString(vec.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vecWrapped, err := hex.DecodeString(vec.Wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w, err := WrapKey(vecKEK, vecKey)
+		if err != nil {
+			t.Fatalf("[%d]: WrapKey: %v", i, err)
+		}
+		assertEqual(t, i, vecWrapped, w)
+
+		k, err := UnwrapKey(vecKEK, vecWrapped)
+		if err != nil {
+			t.Fatalf("[%d]: UnwrapKey: %v", i, err)
+		}
+		assertEqual(t, i, vecKey, k)
+
+		vecWrapped[len(vecWrapped)-1] ^= 0x01
+		if _, err = UnwrapKey(vecKEK, vecWrapped); err == nil {
+			t.Fatalf("[%d]: UnwrapKey accepted corrupted wrapped key", i)
+		}
+	}
+
+	kek := make([]byte, extractedKeySize)
+	for _, sz := range []int{0, 1, MinWrapKeySize - 1, MaxWrapKeySize + 1} {
+		if _, err := WrapKey(kek, make([]byte, sz)); err == nil {
+			t.Fatalf("WrapKey: accepted key size: %d", sz)
+		}
+		if _, err := UnwrapKey(kek, make([]byte, sz+WrapTagSize)); err == nil {
+			t.Fatalf("UnwrapKey: accepted wrapped key size: %d", sz+WrapTagSize)
+		}
+	}
+	if _, err := WrapKey(nil, make([]byte, MinWrapKeySize)); err == nil {
+		t.Fatalf("WrapKey: accepted empty kek")
+	}
+	if _, err := UnwrapKey(nil, make([]byte, MinWrapKeySize+WrapTagSize)); err == nil {
+		t.Fatalf("UnwrapKey: accepted empty kek")
+	}
+}
@@ -0,0 +1,381 @@
+// encrypted_file.go - Random-access encrypted files.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// FileSectorSize is the size of each plaintext sector of an
+	// EncryptedFile in bytes.
+	FileSectorSize = 4096
+
+	// FileSectorTagSize is the size of the authentication tag appended to
+	// each sector of an EncryptedFile in bytes.
+	FileSectorTagSize = 16
+
+	fileEncSectorSize = FileSectorSize + FileSectorTagSize
+)
+
+var (
+	errInvalidOffset     = errors.New("aez: Invalid offset")
+	errInvalidBackingLen = errors.New("aez: Invalid backing storage size")
+)
+
+// FileStorage is the backing storage of an EncryptedFile.  *os.File
+// implements this interface.
+type FileStorage interface {
+	io.ReaderAt
+	io.WriterAt
+
+	// Truncate changes the size of the storage.
+	Truncate(size int64) error
+
+	// Sync commits the contents of the storage to stable storage.
+	Sync() error
+
+	// Stat returns the os.FileInfo describing the storage.
+	Stat() (os.FileInfo, error)
+}
+
+// EncryptedFile is a random-access encrypted file, backed by a FileStorage.
+//
+// The plaintext is split into sectors of FileSectorSize bytes, with the final
+// sector being between 1 and FileSectorSize bytes long.  Sector i (numbered
+// from 0) is stored at offset i*(FileSectorSize+FileSectorTagSize) as:
+//
+//   Encrypt(key, nil, [][]byte{fileID, uint64BE(i), {final}}, FileSectorTagSize, sector)
+//
+// where final is 0x01 for the last sector and 0x00 otherwise.  Binding the
+// sector number prevents sectors from being moved within a file, binding the
+// file ID prevents sectors from being moved between files, and binding the
+// final flag detects truncation of the file.  As AEZ is misuse resistant,
+// sectors are rewritten in place with no nonce, at the cost of revealing
+// if a sector is rewritten with identical contents.  Rolling back the file
+// (or individual sectors) to a previous version is NOT detected.
+//
+// An EncryptedFile is safe for concurrent use by multiple goroutines.
+type EncryptedFile struct {
+	c      Cipher
+	mu     sync.RWMutex
+	s      FileStorage
+	fileID []byte
+}
+
+func (f *EncryptedFile) sectorAD(sector uint64, final bool, ad *[3][]byte, buf *[9]byte) [][]byte {
+	binary.BigEndian.PutUint64(buf[:8], sector)
+	buf[8] = 0x00
+	if final {
+		buf[8] = 0x01
+	}
+	ad[0], ad[1], ad[2] = f.fileID, buf[:8], buf[8:]
+	return ad[:]
+}
+
+// size returns the plaintext size of the file, derived from the size of the
+// backing storage.
+func (f *EncryptedFile) size() (int64, error) {
+	fi, err := f.s.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	physSize := fi.Size()
+	sz := (physSize / fileEncSectorSize) * FileSectorSize
+	if rem := physSize % fileEncSectorSize; rem != 0 {
+		if rem <= FileSectorTagSize {
+			return 0, errInvalidBackingLen
+		}
+		sz += rem - FileSectorTagSize
+	}
+	return sz, nil
+}
+
+func physicalSize(size int64) int64 {
+	physSize := (size / FileSectorSize) * fileEncSectorSize
+	if rem := size % FileSectorSize; rem != 0 {
+		physSize += rem + FileSectorTagSize
+	}
+	return physSize
+}
+
+func sectorLen(sector uint64, size int64) int {
+	start := int64(sector) * FileSectorSize
+	if start >= size {
+		return 0
+	}
+	if size-start > FileSectorSize {
+		return FileSectorSize
+	}
+	return int(size - start)
+}
+
+// readSector decrypts the sector of a file of the provided size, appending
+// the plaintext to dst.
+func (f *EncryptedFile) readSector(sector uint64, size int64, dst []byte) ([]byte, error) {
+	var ad [3][]byte
+	var adBuf [9]byte
+	var buf [fileEncSectorSize]byte
+	defer memwipe(buf[:])
+
+	sLen := sectorLen(sector, size)
+	if sLen == 0 {
+		return dst, nil
+	}
+	final := int64(sector+1)*FileSectorSize >= size
+
+	b := buf[:sLen+FileSectorTagSize]
+	n, err := f.s.ReadAt(b, int64(sector)*fileEncSectorSize)
+	if n != len(b) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	dst, ok := f.c.Decrypt(nil, f.sectorAD(sector, final, &ad, &adBuf), FileSectorTagSize, b, dst)
+	if !ok {
+		return nil, errOpen
+	}
+	return dst, nil
+}
+
+// writeSector encrypts and writes the sector of a file of the provided size.
+func (f *EncryptedFile) writeSector(sector uint64, size int64, plaintext []byte) error {
+	var ad [3][]byte
+	var adBuf [9]byte
+	var buf [fileEncSectorSize]byte
+	defer memwipe(buf[:])
+
+	final := int64(sector+1)*FileSectorSize >= size
+
+	b := f.c.Encrypt(nil, f.sectorAD(sector, final, &ad, &adBuf), FileSectorTagSize, plaintext, buf[:0])
+	_, err := f.s.WriteAt(b, int64(sector)*fileEncSectorSize)
+	return err
+}
+
+// update writes p at off, and resizes the file from oldSize to newSize,
+// re-encrypting all of the affected sectors.
+func (f *EncryptedFile) update(p []byte, off, oldSize, newSize int64) error {
+	var buf [fileEncSectorSize]byte
+	defer memwipe(buf[:])
+
+	// Determine the range of bytes that need to be re-encrypted.
+	lo, hi := off, off+int64(len(p))
+	if newSize != oldSize {
+		// The old and new final sectors, and everything in between
+		// need to be rewritten, as the final flag and sector sizes
+		// change.  This includes any gap between the old end of file
+		// and the data being written.
+		lo = minInt64(lo, oldSize)
+		if oldSize > 0 {
+			lo = minInt64(lo, ((oldSize-1)/FileSectorSize)*FileSectorSize)
+		}
+		if newSize > 0 {
+			lo = minInt64(lo, ((newSize-1)/FileSectorSize)*FileSectorSize)
+		}
+		if newSize > hi {
+			hi = newSize
+		}
+	}
+	hi = minInt64(hi, newSize)
+	if hi <= lo {
+		return f.resize(oldSize, newSize)
+	}
+	first, last := uint64(lo/FileSectorSize), uint64((hi-1)/FileSectorSize)
+
+	for sector := first; sector <= last; sector++ {
+		sStart := int64(sector) * FileSectorSize
+
+		// Decrypt the existing contents of the sector, if any.
+		pt, err := f.readSector(sector, oldSize, buf[:0])
+		if err != nil {
+			return err
+		}
+
+		// Resize the sector, zero-extending as required.
+		newLen := sectorLen(sector, newSize)
+		if len(pt) < newLen {
+			memwipe(buf[len(pt):newLen])
+		}
+		pt = buf[:newLen]
+
+		// Overlay the data being written.
+		if sEnd := sStart + int64(newLen); off < sEnd && off+int64(len(p)) > sStart {
+			pOff, sOff := int64(0), off-sStart
+			if sOff < 0 {
+				pOff, sOff = -sOff, 0
+			}
+			copy(pt[sOff:], p[pOff:])
+		}
+
+		if err = f.writeSector(sector, newSize, pt); err != nil {
+			return err
+		}
+	}
+
+	return f.resize(oldSize, newSize)
+}
+
+func (f *EncryptedFile) resize(oldSize, newSize int64) error {
+	if newSize < oldSize {
+		return f.s.Truncate(physicalSize(newSize))
+	}
+	return nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Size returns the size of the plaintext stored in the file in bytes.
+func (f *EncryptedFile) Size() (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.size()
+}
+
+// ReadAt reads len(p) bytes of plaintext into p starting at offset off,
+// per the io.ReaderAt interface.  An error is returned if any sector read
+// fails authentication.
+func (f *EncryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	var buf [fileEncSectorSize]byte
+	defer memwipe(buf[:])
+
+	if off < 0 {
+		return 0, errInvalidOffset
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	size, err := f.size()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		if off >= size {
+			return n, io.EOF
+		}
+
+		sector := uint64(off / FileSectorSize)
+		pt, err := f.readSector(sector, size, buf[:0])
+		if err != nil {
+			return n, err
+		}
+
+		copied := copy(p, pt[off-int64(sector)*FileSectorSize:])
+		p = p[copied:]
+		n += copied
+		off += int64(copied)
+	}
+
+	return n, nil
+}
+
+// WriteAt writes len(p) bytes of plaintext from p starting at offset off,
+// per the io.WriterAt interface.  Writing past the end of the file extends
+// the file, with any gap being filled with 0x00 bytes.  Zero length writes
+// never extend the file.
+func (f *EncryptedFile) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errInvalidOffset
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	size, err := f.size()
+	if err != nil {
+		return 0, err
+	}
+	newSize := size
+	if end := off + int64(len(p)); end > newSize {
+		newSize = end
+	}
+
+	if err = f.update(p, off, size, newSize); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Truncate changes the size of the plaintext stored in the file.  Extending
+// the file fills the new region with 0x00 bytes.
+func (f *EncryptedFile) Truncate(size int64) error {
+	if size < 0 {
+		return errInvalidOffset
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	oldSize, err := f.size()
+	if err != nil {
+		return err
+	}
+	switch {
+	case size > oldSize:
+		return f.update(nil, oldSize, oldSize, size)
+	case size < oldSize:
+		return f.update(nil, size, oldSize, size)
+	}
+	return nil
+}
+
+// Sync commits the contents of the backing storage to stable storage.
+func (f *EncryptedFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.s.Sync()
+}
+
+// Reset clears the sensitive keying material from the datastructure such
+// that it will no longer be in memory.  The backing storage is not closed.
+func (f *EncryptedFile) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.c.Reset()
+}
+
+// NewEncryptedFile returns a new EncryptedFile backed by s, keyed with the
+// provided key.  The fileID should be unique for each file encrypted with a
+// given key.
+func NewEncryptedFile(s FileStorage, key, fileID []byte) (*EncryptedFile, error) {
+	if len(key) == 0 {
+		return nil, errInvalidKeySize
+	}
+
+	f := &EncryptedFile{
+		s:      s,
+		fileID: append([]byte{}, fileID...),
+	}
+	f.c.e.init(key)
+
+	if _, err := f.size(); err != nil {
+		f.c.Reset()
+		return nil, err
+	}
+	return f, nil
+}
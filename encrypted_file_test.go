@@ -0,0 +1,203 @@
+// encrypted_file_test.go - Random-access encrypted file tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"os"
+	"testing"
+)
+
+func newTestEncryptedFile(t *testing.T, key, fileID []byte) (*EncryptedFile, *os.File) {
+	fs, err := ioutil.TempFile("", "aez-encrypted-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(fs.Name())
+
+	f, err := NewEncryptedFile(fs, key, fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, fs
+}
+
+func assertEncryptedFileContents(t *testing.T, f *EncryptedFile, expected []byte) {
+	sz, err := f.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz != int64(len(expected)) {
+		t.Fatalf("Size: %d != %d", sz, len(expected))
+	}
+
+	b := make([]byte, len(expected)+10)
+	n, err := f.ReadAt(b, 0)
+	if err != io.EOF {
+		t.Fatalf("ReadAt: unexpected error: %v", err)
+	}
+	assertEqual(t, 0, expected, b[:n])
+}
+
+func TestEncryptedFile(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	f, fs := newTestEncryptedFile(t, key[:], []byte("file 0"))
+	defer fs.Close()
+	defer f.Reset()
+
+	// Apply random writes and truncations to both the EncryptedFile and
+	// an in-memory model, and ensure the contents always match.
+	rng := mrand.New(mrand.NewSource(0))
+	var model []byte
+	for i := 0; i < 200; i++ {
+		switch rng.Intn(4) {
+		case 0: // Truncate
+			sz := int64(rng.Intn(5 * FileSectorSize))
+			if err := f.Truncate(sz); err != nil {
+				t.Fatalf("[%d]: Truncate(%d): %v", i, sz, err)
+			}
+			if sz < int64(len(model)) {
+				model = model[:sz]
+			} else {
+				model = append(model, make([]byte, sz-int64(len(model)))...)
+			}
+		default: // WriteAt
+			off := int64(rng.Intn(5 * FileSectorSize))
+			p := make([]byte, rng.Intn(3*FileSectorSize))
+			rng.Read(p)
+			if n, err := f.WriteAt(p, off); err != nil || n != len(p) {
+				t.Fatalf("[%d]: WriteAt(%d, %d): %d %v", i, len(p), off, n, err)
+			}
+			if end := off + int64(len(p)); len(p) > 0 && end > int64(len(model)) {
+				model = append(model, make([]byte, end-int64(len(model)))...)
+			}
+			copy(model[off:], p)
+		}
+		assertEncryptedFileContents(t, f, model)
+
+		// Random partial read.
+		if len(model) > 0 {
+			off := rng.Intn(len(model))
+			b := make([]byte, rng.Intn(len(model)-off)+1)
+			if _, err := f.ReadAt(b, int64(off)); err != nil {
+				t.Fatalf("[%d]: ReadAt: %v", i, err)
+			}
+			assertEqual(t, i, model[off:off+len(b)], b)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Zero length writes past the end of the file do not extend it.
+	if n, err := f.WriteAt(nil, int64(len(model))+3*FileSectorSize); err != nil || n != 0 {
+		t.Fatalf("WriteAt(0, past EOF): %d %v", n, err)
+	}
+	assertEncryptedFileContents(t, f, model)
+
+	// Reopening with the same key and file ID must work.
+	f2, err := NewEncryptedFile(fs, key[:], []byte("file 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEncryptedFileContents(t, f2, model)
+	f2.Reset()
+
+	// A different file ID must fail.
+	f3, err := NewEncryptedFile(fs, key[:], []byte("file 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f3.ReadAt(make([]byte, 1), 0); err != errOpen {
+		t.Fatalf("ReadAt: accepted incorrect file ID: %v", err)
+	}
+	f3.Reset()
+}
+
+func TestEncryptedFileTamper(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	f, fs := newTestEncryptedFile(t, key[:], nil)
+	defer fs.Close()
+	defer f.Reset()
+
+	data := make([]byte, 3*FileSectorSize+100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := make([]byte, physicalSize(int64(len(data))))
+	if _, err := fs.ReadAt(raw, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	restore := func() {
+		if err := fs.Truncate(0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.WriteAt(raw, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Swapped sectors.
+	swapped := append([]byte{}, raw...)
+	copy(swapped, raw[fileEncSectorSize:2*fileEncSectorSize])
+	copy(swapped[fileEncSectorSize:], raw[:fileEncSectorSize])
+	if _, err := fs.WriteAt(swapped, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadAt(make([]byte, 1), 0); err != errOpen {
+		t.Fatalf("ReadAt: accepted swapped sector: %v", err)
+	}
+	restore()
+
+	// Truncation at a sector boundary.
+	if err := fs.Truncate(2 * fileEncSectorSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadAt(make([]byte, 1), FileSectorSize+1); err != errOpen {
+		t.Fatalf("ReadAt: accepted truncated file: %v", err)
+	}
+	restore()
+
+	// Corrupted sector.
+	if _, err := fs.WriteAt([]byte{raw[10] ^ 0x01}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadAt(make([]byte, 1), 0); err != errOpen {
+		t.Fatalf("ReadAt: accepted corrupted sector: %v", err)
+	}
+	if _, err := f.ReadAt(make([]byte, 1), FileSectorSize); err != nil {
+		t.Fatalf("ReadAt: rejected valid sector: %v", err)
+	}
+	restore()
+
+	assertEncryptedFileContents(t, f, data)
+
+	// Invalid backing storage size.
+	if err := fs.Truncate(fileEncSectorSize + FileSectorTagSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Size(); err != errInvalidBackingLen {
+		t.Fatalf("Size: accepted invalid backing storage size: %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+// file.go - Out-of-core encryption of large messages.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"errors"
+	"io"
+)
+
+// The window size MUST be a multiple of 256 bytes (8 block pairs), so that
+// each window starts at a block pair with an index of 1 modulo 8.
+const fileWindowSize = 64 * 1024
+
+var errInvalidLength = errors.New("aez: Invalid length")
+
+// fileSource reads the logical input of AEZ from an io.ReaderAt, where all
+// bytes at or past n are 0x00 (the tau bytes of padding).
+type fileSource struct {
+	r io.ReaderAt
+	n int64
+}
+
+func (s *fileSource) readAt(b []byte, off int64) error {
+	toRead := int64(len(b))
+	if off+toRead > s.n {
+		toRead = s.n - off
+		if toRead < 0 {
+			toRead = 0
+		}
+		memwipe(b[toRead:])
+	}
+	if toRead > 0 {
+		n, err := s.r.ReadAt(b[:toRead], off)
+		if int64(n) != toRead {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// fileSink writes the output of AEZ to an io.WriterAt, where all bytes at
+// or past n are checked to be 0x00 (the tau bytes of padding) rather than
+// written.  written is the end of the furthest write, which may have been
+// partial.
+type fileSink struct {
+	w       io.WriterAt
+	n       int64
+	written int64
+	sum     byte
+}
+
+func (s *fileSink) writeAt(b []byte, off int64) error {
+	toWrite := int64(len(b))
+	if off+toWrite > s.n {
+		toWrite = s.n - off
+		if toWrite < 0 {
+			toWrite = 0
+		}
+		for _, v := range b[toWrite:] {
+			s.sum |= v
+		}
+	}
+	if toWrite > 0 {
+		if off+toWrite > s.written {
+			s.written = off + toWrite
+		}
+		if _, err := s.w.WriteAt(b[:toWrite], off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wipe overwrites everything that has been written with 0x00 bytes.
+func (s *fileSink) wipe() error {
+	var buf [fileWindowSize]byte
+	for off := int64(0); off < s.written; off += fileWindowSize {
+		toWrite := s.written - off
+		if toWrite > fileWindowSize {
+			toWrite = fileWindowSize
+		}
+		if _, err := s.w.WriteAt(buf[:toWrite], off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aezCoreFile is aezCore, that processes the length byte input in windows
+// of at most fileWindowSize bytes, rather than entirely in memory.
+//
+// The intermediate values from the first pass are not retained, and are
+// instead recomputed (discarding X) from the input during the second pass,
+// so that dst does not need to be readable.
+func (e *eState) aezCoreFile(delta *[blockSize]byte, src *fileSource, length int64, d uint, dst *fileSink) error {
+	var X, Y, S, I, discard [blockSize]byte
+	var tail [64]byte
+	defer memwipe(X[:])
+	defer memwipe(Y[:])
+	defer memwipe(S[:])
+	defer memwipe(I[:])
+	defer memwipe(discard[:])
+	defer memwipe(tail[:])
+
+	fragBytes := int(length % 32)
+	initialBytes := length - int64(fragBytes) - 32
+
+	winSz := int64(fileWindowSize)
+	if initialBytes < winSz {
+		winSz = initialBytes
+	}
+	win := make([]byte, winSz)
+	defer memwipe(win)
+
+	// Pass 1 over in[0:-32], in windows, discarding the intermediate values.
+	copy(I[:], e.I[1][:])
+	for off := int64(0); off < initialBytes; off += int64(len(win)) {
+		b := win
+		if rem := initialBytes - off; rem < int64(len(b)) {
+			b = b[:rem]
+		}
+		if err := src.readAt(b, off); err != nil {
+			return err
+		}
+		e.aezCorePass1(b, b, &X, &I, len(b))
+		advanceI(&I, len(b))
+	}
+
+	// Finish X calculation, calculate S.
+	t := tail[:length-initialBytes]
+	if err := src.readAt(t, initialBytes); err != nil {
+		return err
+	}
+	e.aezCoreFragX(t[:fragBytes], &X)
+	e.aezCoreS(delta, t[fragBytes:], d, t[fragBytes:], &X, &S)
+
+	// Pass 2, in windows, recomputing the intermediate values.
+	copy(I[:], e.I[1][:])
+	for off := int64(0); off < initialBytes; off += int64(len(win)) {
+		b := win
+		if rem := initialBytes - off; rem < int64(len(b)) {
+			b = b[:rem]
+		}
+		if err := src.readAt(b, off); err != nil {
+			return err
+		}
+		e.aezCorePass1(b, b, &discard, &I, len(b))
+		e.aezCorePass2(b, b, &Y, &S, &I, len(b))
+		if err := dst.writeAt(b, off); err != nil {
+			return err
+		}
+		advanceI(&I, len(b))
+	}
+
+	// Finish Y calculation, finish encryption of the last two blocks.
+	e.aezCoreFragY(t[:fragBytes], t[:fragBytes], &Y, &S)
+	e.aezCoreFinal(delta, d, t[fragBytes:], &Y)
+
+	return dst.writeAt(t, initialBytes)
+}
+
+// advanceI updates I to the value used by the block pair following sz bytes
+// of block pairs.  sz MUST be a multiple of 256 bytes unless it is the last
+// call.
+func advanceI(I *[blockSize]byte, sz int) {
+	for i := 0; i < sz/256; i++ {
+		doubleBlock(I)
+	}
+}
+
+func (e *eState) encryptFile(nonce []byte, additionalData [][]byte, tau int, src io.ReaderAt, srcLen int64, dst io.WriterAt) error {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	if srcLen < 0 || tau < 0 {
+		return errInvalidLength
+	}
+	length := srcLen + int64(tau)
+
+	// AEZ-prf output is generated in windows.
+	if srcLen == 0 {
+		var buf [fileWindowSize]byte
+		defer memwipe(buf[:])
+
+		e.aezHash(nonce, additionalData, tau*8, delta[:])
+		for off := int64(0); off < length; off += fileWindowSize {
+			b := buf[:]
+			if rem := length - off; rem < int64(len(b)) {
+				b = b[:rem]
+			}
+			e.aezPRFAt(&delta, off, b)
+			if _, err := dst.WriteAt(b, off); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Messages that will not use the windowed aezCore are small enough
+	// to be processed in memory.
+	if length < 32 {
+		b := make([]byte, srcLen)
+		defer memwipe(b)
+		if err := (&fileSource{src, srcLen}).readAt(b, 0); err != nil {
+			return err
+		}
+		c := e.encrypt(nonce, additionalData, tau, b, nil)
+		_, err := dst.WriteAt(c, 0)
+		return err
+	}
+
+	e.aezHash(nonce, additionalData, tau*8, delta[:])
+	return e.aezCoreFile(&delta, &fileSource{src, srcLen}, length, 0, &fileSink{w: dst, n: length})
+}
+
+func (e *eState) decryptFile(nonce []byte, additionalData [][]byte, tau int, src io.ReaderAt, srcLen int64, dst io.WriterAt) error {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	if srcLen < int64(tau) || tau < 0 {
+		return errInvalidLength
+	}
+
+	// The AEZ-prf tag is checked in windows, and nothing is written.
+	if srcLen == int64(tau) {
+		var buf, ct [fileWindowSize]byte
+		defer memwipe(buf[:])
+
+		sum := byte(0)
+		e.aezHash(nonce, additionalData, tau*8, delta[:])
+		for off := int64(0); off < srcLen; off += fileWindowSize {
+			b, c := buf[:], ct[:]
+			if rem := srcLen - off; rem < int64(len(b)) {
+				b, c = b[:rem], c[:rem]
+			}
+			if err := (&fileSource{src, srcLen}).readAt(c, off); err != nil {
+				return err
+			}
+			e.aezPRFAt(&delta, off, b)
+			for i := range b {
+				sum |= b[i] ^ c[i]
+			}
+		}
+		if sum != 0 {
+			return errOpen
+		}
+		return nil
+	}
+
+	// Messages that will not use the windowed aezCore are small enough
+	// to be processed in memory.
+	if srcLen < 32 {
+		b := make([]byte, srcLen)
+		defer memwipe(b)
+		if err := (&fileSource{src, srcLen}).readAt(b, 0); err != nil {
+			return err
+		}
+		m, ok := e.decrypt(nonce, additionalData, tau, b, nil)
+		if !ok {
+			return errOpen
+		}
+		defer memwipe(m)
+		_, err := dst.WriteAt(m, 0)
+		return err
+	}
+
+	sink := &fileSink{w: dst, n: srcLen - int64(tau)}
+	e.aezHash(nonce, additionalData, tau*8, delta[:])
+	if err := e.aezCoreFile(&delta, &fileSource{src, srcLen}, srcLen, 1, sink); err != nil {
+		// Unverified plaintext may have been written, overwrite it.
+		sink.wipe()
+		return err
+	}
+	if sink.sum != 0 {
+		// Unverified plaintext has been written, overwrite it.
+		if err := sink.wipe(); err != nil {
+			return err
+		}
+		return errOpen
+	}
+	return nil
+}
+
+// EncryptFile encrypts and authenticates the srcLen byte plaintext read from
+// src, authenticates the additional data, and writes the srcLen+tau byte
+// ciphertext to dst at offset 0.  The output is identical to that of
+// Encrypt, however the message is processed in fixed size windows, so the
+// memory required is independent of the message length.  Note that as AEZ
+// is a two-pass construction, the plaintext is read from src multiple times.
+func EncryptFile(key []byte, nonce []byte, additionalData [][]byte, tau int, src io.ReaderAt, srcLen int64, dst io.WriterAt) error {
+	var e eState
+	defer e.reset()
+
+	e.init(key)
+	return e.encryptFile(nonce, additionalData, tau, src, srcLen, dst)
+}
+
+// DecryptFile decrypts and authenticates the srcLen byte ciphertext read from
+// src, authenticates the additional data, and writes the srcLen-tau byte
+// plaintext to dst at offset 0.  The message is processed in fixed size
+// windows, so the memory required is independent of the message length.
+//
+// As the plaintext is written to dst before the authentication tag can be
+// checked, on authentication failure the plaintext written to dst is
+// overwritten with 0x00 bytes prior to returning an error.
+func DecryptFile(key []byte, nonce []byte, additionalData [][]byte, tau int, src io.ReaderAt, srcLen int64, dst io.WriterAt) error {
+	var e eState
+	defer e.reset()
+
+	e.init(key)
+	return e.decryptFile(nonce, additionalData, tau, src, srcLen, dst)
+}
+
+// EncryptFile encrypts and authenticates the srcLen byte plaintext read from
+// src, authenticates the additional data, and writes the srcLen+tau byte
+// ciphertext to dst at offset 0.  The output is identical to that of
+// Encrypt, however the message is processed in fixed size windows, so the
+// memory required is independent of the message length.  Note that as AEZ
+// is a two-pass construction, the plaintext is read from src multiple times.
+func (c *Cipher) EncryptFile(nonce []byte, additionalData [][]byte, tau int, src io.ReaderAt, srcLen int64, dst io.WriterAt) error {
+	return c.e.encryptFile(nonce, additionalData, tau, src, srcLen, dst)
+}
+
+// DecryptFile decrypts and authenticates the srcLen byte ciphertext read from
+// src, authenticates the additional data, and writes the srcLen-tau byte
+// plaintext to dst at offset 0.  The message is processed in fixed size
+// windows, so the memory required is independent of the message length.
+//
+// As the plaintext is written to dst before the authentication tag can be
+// checked, on authentication failure the plaintext written to dst is
+// overwritten with 0x00 bytes prior to returning an error.
+func (c *Cipher) DecryptFile(nonce []byte, additionalData [][]byte, tau int, src io.ReaderAt, srcLen int64, dst io.WriterAt) error {
+	return c.e.decryptFile(nonce, additionalData, tau, src, srcLen, dst)
+}
@@ -0,0 +1,177 @@
+// file_test.go - Out-of-core encryption tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+type memFile struct {
+	b []byte
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f.b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := off + int64(len(p)); end > int64(len(f.b)) {
+		f.b = append(f.b, make([]byte, end-int64(len(f.b)))...)
+	}
+	return copy(f.b[off:], p), nil
+}
+
+// failingFile is a memFile that fails all reads after the first reads.
+type failingFile struct {
+	memFile
+	reads int
+}
+
+func (f *failingFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.reads == 0 {
+		return 0, errors.New("aez: test read failure")
+	}
+	f.reads--
+	return f.memFile.ReadAt(p, off)
+}
+
+func TestEncryptDecryptFile(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	var nonce [16]byte
+	ad := [][]byte{[]byte("file")}
+	sizes := []int{
+		0, 1, 15, 16, 31, 32, 33, 48, 63, 64, 100, 255, 256, 257,
+		fileWindowSize - 1, fileWindowSize, fileWindowSize + 1,
+		3*fileWindowSize + 12345,
+	}
+	for _, sz := range sizes {
+		plaintext := make([]byte, sz)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tau := range []int{0, 1, 16, 100, 300} {
+			expected := c.Encrypt(nonce[:], ad, tau, plaintext, nil)
+
+			ct := new(memFile)
+			if err := c.EncryptFile(nonce[:], ad, tau, bytes.NewReader(plaintext), int64(sz), ct); err != nil {
+				t.Fatalf("[%d/%d]: EncryptFile: %v", sz, tau, err)
+			}
+			assertEqual(t, sz, expected, ct.b)
+
+			pt := new(memFile)
+			if err := c.DecryptFile(nonce[:], ad, tau, ct, int64(len(ct.b)), pt); err != nil {
+				t.Fatalf("[%d/%d]: DecryptFile: %v", sz, tau, err)
+			}
+			assertEqual(t, sz, plaintext, pt.b)
+
+			// Forgeries succeed with probability 2^-(8*tau), so only
+			// check rejection with tags large enough to not be flaky.
+			if tau < 4 || len(ct.b) == 0 {
+				continue
+			}
+
+			// Authentication failures must not leave plaintext in dst.
+			ct.b[len(ct.b)/2] ^= 0x01
+			pt = new(memFile)
+			if err := c.DecryptFile(nonce[:], ad, tau, ct, int64(len(ct.b)), pt); err != errOpen {
+				t.Fatalf("[%d/%d]: DecryptFile accepted corrupted ciphertext: %v", sz, tau, err)
+			}
+			if !bytes.Equal(pt.b, make([]byte, len(pt.b))) {
+				t.Fatalf("[%d/%d]: DecryptFile left unverified plaintext in dst", sz, tau)
+			}
+		}
+	}
+
+	// AEZ-prf output larger than a window.
+	for _, tau := range []int{fileWindowSize, 2*fileWindowSize + 100} {
+		expected := c.Encrypt(nonce[:], ad, tau, nil, nil)
+		ct := new(memFile)
+		if err := c.EncryptFile(nonce[:], ad, tau, bytes.NewReader(nil), 0, ct); err != nil {
+			t.Fatalf("[0/%d]: EncryptFile: %v", tau, err)
+		}
+		assertEqual(t, tau, expected, ct.b)
+		pt := new(memFile)
+		if err := c.DecryptFile(nonce[:], ad, tau, ct, int64(len(ct.b)), pt); err != nil {
+			t.Fatalf("[0/%d]: DecryptFile: %v", tau, err)
+		}
+		ct.b[len(ct.b)-1] ^= 0x01
+		if err := c.DecryptFile(nonce[:], ad, tau, ct, int64(len(ct.b)), pt); err != errOpen {
+			t.Fatalf("[0/%d]: DecryptFile accepted corrupted tag: %v", tau, err)
+		}
+		if len(pt.b) != 0 {
+			t.Fatalf("[0/%d]: DecryptFile wrote to dst", tau)
+		}
+	}
+
+	// I/O errors part way through decryption must not leave plaintext
+	// in dst.
+	{
+		plaintext := make([]byte, 3*fileWindowSize)
+		for i := range plaintext {
+			plaintext[i] = 0xaa
+		}
+		ct := new(failingFile)
+		if err := c.EncryptFile(nonce[:], ad, 16, bytes.NewReader(plaintext), int64(len(plaintext)), &ct.memFile); err != nil {
+			t.Fatal(err)
+		}
+		for reads := 0; ; reads++ {
+			ct.reads = reads
+			pt := new(memFile)
+			if err := c.DecryptFile(nonce[:], ad, 16, ct, int64(len(ct.b)), pt); err == nil {
+				assertEqual(t, reads, plaintext, pt.b)
+				break
+			}
+			if !bytes.Equal(pt.b, make([]byte, len(pt.b))) {
+				t.Fatalf("[%d]: DecryptFile left unverified plaintext in dst", reads)
+			}
+		}
+	}
+
+	// The one-shot variants.
+	plaintext := make([]byte, 1000)
+	ct := new(memFile)
+	if err := EncryptFile(key[:], nonce[:], nil, 16, bytes.NewReader(plaintext), int64(len(plaintext)), ct); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 0, Encrypt(key[:], nonce[:], nil, 16, plaintext, nil), ct.b)
+	pt := new(memFile)
+	if err := DecryptFile(key[:], nonce[:], nil, 16, ct, int64(len(ct.b)), pt); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 0, plaintext, pt.b)
+
+	// Short sources.
+	if err := c.EncryptFile(nonce[:], nil, 16, bytes.NewReader(plaintext), int64(len(plaintext)+1), ct); err == nil {
+		t.Fatalf("EncryptFile: accepted short source")
+	}
+	if err := c.DecryptFile(nonce[:], nil, 16, ct, 15, pt); err == nil {
+		t.Fatalf("DecryptFile: accepted ciphertext shorter than tau")
+	}
+}
@@ -0,0 +1,226 @@
+// fpe.go - Format-preserving encryption.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"errors"
+	"math/big"
+	"unicode/utf8"
+)
+
+// DecimalAlphabet is the alphabet of decimal digits, for use with
+// FPE.EncryptString and FPE.DecryptString.
+const DecimalAlphabet = "0123456789"
+
+var (
+	errInvalidFPEDomain = errors.New("aez: Invalid FPE domain")
+	errInvalidFPEInput  = errors.New("aez: Invalid FPE input")
+
+	fpeDomainPrefix = []byte("AEZ-FPE")
+)
+
+// FPE is AEZ used as a format-preserving encryption scheme, which enciphers
+// integers in [0, modulus) to integers in [0, modulus), and strings over an
+// alphabet to strings of the same length over the same alphabet.
+//
+// Integers are enciphered as fixed-width big endian byte strings with the
+// AEZ arbitrary-input-length tweakable cipher, using cycle-walking (repeatedly
+// enciphering until the result is in the domain) to restrict the permutation
+// to [0, modulus).  The modulus is bound into the tweak, so each domain has an
+// independent permutation.  As the cipher operates on bytes, the expected
+// number of encipherings per call is less than 256 (and approximately 1 when
+// the modulus is slightly less than a power of 256).  Cycle-walking is
+// variable-time, as the number of encipherings depends on the input, so the
+// execution time reveals information about the input to the permutation.
+//
+// As with all format-preserving encryption, no authenticity is provided, and
+// identical inputs under the same tweak result in identical outputs.  Small
+// domains offer correspondingly small security margins.
+type FPE struct {
+	c Cipher
+}
+
+// fpeDomain contains the state required to encipher elements of [0, modulus).
+type fpeDomain struct {
+	modulus *big.Int
+	tweak   [][]byte
+	buf     []byte
+}
+
+func newFPEDomain(modulus *big.Int, tweak [][]byte) (*fpeDomain, error) {
+	if modulus == nil || modulus.Cmp(big.NewInt(2)) < 0 {
+		return nil, errInvalidFPEDomain
+	}
+
+	d := &fpeDomain{
+		modulus: modulus,
+		buf:     make([]byte, (new(big.Int).Sub(modulus, big.NewInt(1)).BitLen()+7)/8),
+	}
+	d.tweak = make([][]byte, 0, 1+len(tweak))
+	d.tweak = append(d.tweak, append(append([]byte{}, fpeDomainPrefix...), modulus.Bytes()...))
+	d.tweak = append(d.tweak, tweak...)
+
+	return d, nil
+}
+
+func (f *FPE) cycleWalk(d *fpeDomain, x *big.Int, dir uint) (*big.Int, error) {
+	if x == nil || x.Sign() < 0 || x.Cmp(d.modulus) >= 0 {
+		return nil, errInvalidFPEInput
+	}
+	defer memwipe(d.buf)
+
+	b := x.Bytes()
+	memwipe(d.buf)
+	copy(d.buf[len(d.buf)-len(b):], b)
+
+	// As the cipher is a permutation over all len(d.buf) byte strings,
+	// repeatedly applying it until the result is in the domain gives a
+	// permutation over the domain.
+	y := new(big.Int)
+	for {
+		f.c.e.tweakedCipher(d.tweak, d.buf, d.buf, dir)
+		if y.SetBytes(d.buf).Cmp(d.modulus) < 0 {
+			return y, nil
+		}
+	}
+}
+
+// EncryptInt enciphers x, which MUST be in [0, modulus), under the provided
+// vector tweak, returning the result, which will be in [0, modulus).  The
+// modulus MUST be at least 2.
+func (f *FPE) EncryptInt(modulus, x *big.Int, tweak [][]byte) (*big.Int, error) {
+	d, err := newFPEDomain(modulus, tweak)
+	if err != nil {
+		return nil, err
+	}
+	return f.cycleWalk(d, x, 0)
+}
+
+// DecryptInt deciphers x, which MUST be in [0, modulus), under the provided
+// vector tweak, returning the result, which will be in [0, modulus).  The
+// modulus MUST be at least 2.
+func (f *FPE) DecryptInt(modulus, x *big.Int, tweak [][]byte) (*big.Int, error) {
+	d, err := newFPEDomain(modulus, tweak)
+	if err != nil {
+		return nil, err
+	}
+	return f.cycleWalk(d, x, 1)
+}
+
+// fpeAlphabet maps between strings over an alphabet and integers.
+type fpeAlphabet struct {
+	runes   []rune
+	indexes map[rune]int64
+}
+
+func newFPEAlphabet(alphabet string) (*fpeAlphabet, error) {
+	if !utf8.ValidString(alphabet) {
+		return nil, errInvalidFPEDomain
+	}
+
+	a := &fpeAlphabet{
+		runes:   []rune(alphabet),
+		indexes: make(map[rune]int64),
+	}
+	for i, r := range a.runes {
+		if _, ok := a.indexes[r]; ok {
+			return nil, errInvalidFPEDomain
+		}
+		a.indexes[r] = int64(i)
+	}
+	if len(a.runes) < 2 {
+		return nil, errInvalidFPEDomain
+	}
+
+	return a, nil
+}
+
+// toInt returns the integer represented by s as a big endian number in the
+// alphabet's radix, and the modulus (radix^len(s)).
+func (a *fpeAlphabet) toInt(s string) (*big.Int, *big.Int, error) {
+	radix := big.NewInt(int64(len(a.runes)))
+	x, modulus := new(big.Int), big.NewInt(1)
+	for _, r := range s {
+		v, ok := a.indexes[r]
+		if !ok {
+			return nil, nil, errInvalidFPEInput
+		}
+		x.Mul(x, radix)
+		x.Add(x, big.NewInt(v))
+		modulus.Mul(modulus, radix)
+	}
+	return x, modulus, nil
+}
+
+// fromInt returns the n character string representing x.
+func (a *fpeAlphabet) fromInt(x *big.Int, n int) string {
+	radix := big.NewInt(int64(len(a.runes)))
+	out := make([]rune, n)
+	v := new(big.Int)
+	for i := n - 1; i >= 0; i-- {
+		x.DivMod(x, radix, v)
+		out[i] = a.runes[v.Int64()]
+	}
+	return string(out)
+}
+
+func (f *FPE) cipherString(alphabet, s string, tweak [][]byte, dir uint) (string, error) {
+	a, err := newFPEAlphabet(alphabet)
+	if err != nil {
+		return "", err
+	}
+	n := utf8.RuneCountInString(s)
+	if n == 0 || !utf8.ValidString(s) {
+		return "", errInvalidFPEInput
+	}
+
+	x, modulus, err := a.toInt(s)
+	if err != nil {
+		return "", err
+	}
+	d, err := newFPEDomain(modulus, tweak)
+	if err != nil {
+		return "", err
+	}
+	if x, err = f.cycleWalk(d, x, dir); err != nil {
+		return "", err
+	}
+	return a.fromInt(x, n), nil
+}
+
+// EncryptString enciphers s, which MUST be a non-empty string consisting of
+// characters in alphabet, under the provided vector tweak, returning a string
+// of the same length over the same alphabet.  The alphabet MUST consist of at
+// least 2 distinct characters.
+func (f *FPE) EncryptString(alphabet, s string, tweak [][]byte) (string, error) {
+	return f.cipherString(alphabet, s, tweak, 0)
+}
+
+// DecryptString deciphers s, which MUST be a non-empty string consisting of
+// characters in alphabet, under the provided vector tweak, returning a string
+// of the same length over the same alphabet.  The alphabet MUST consist of at
+// least 2 distinct characters.
+func (f *FPE) DecryptString(alphabet, s string, tweak [][]byte) (string, error) {
+	return f.cipherString(alphabet, s, tweak, 1)
+}
+
+// Reset clears the sensitive keying material from the datastructure such
+// that it will no longer be in memory.
+func (f *FPE) Reset() {
+	f.c.Reset()
+}
+
+// NewFPE returns a new FPE instance keyed with the provided key.
+func NewFPE(key []byte) (*FPE, error) {
+	if len(key) == 0 {
+		return nil, errInvalidKeySize
+	}
+	f := new(FPE)
+	f.c.e.init(key)
+	return f, nil
+}
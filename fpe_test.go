@@ -0,0 +1,207 @@
+// fpe_test.go - Format-preserving encryption tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func newTestFPE(t *testing.T) *FPE {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewFPE(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFPEIntBijective(t *testing.T) {
+	f := newTestFPE(t)
+	defer f.Reset()
+
+	tweak := [][]byte{[]byte("account numbers")}
+	for _, m := range []int64{2, 3, 10, 100, 255, 256, 257} {
+		modulus := big.NewInt(m)
+		seen := make(map[int64]bool)
+		identity := 0
+		for i := int64(0); i < m; i++ {
+			y, err := f.EncryptInt(modulus, big.NewInt(i), tweak)
+			if err != nil {
+				t.Fatalf("[%d]: EncryptInt(%d): %v", m, i, err)
+			}
+			if y.Sign() < 0 || y.Cmp(modulus) >= 0 {
+				t.Fatalf("[%d]: EncryptInt(%d): out of domain: %v", m, i, y)
+			}
+			if seen[y.Int64()] {
+				t.Fatalf("[%d]: EncryptInt(%d): collision: %v", m, i, y)
+			}
+			seen[y.Int64()] = true
+			if y.Int64() == i {
+				identity++
+			}
+
+			x, err := f.DecryptInt(modulus, y, tweak)
+			if err != nil {
+				t.Fatalf("[%d]: DecryptInt(%v): %v", m, y, err)
+			}
+			if x.Int64() != i {
+				t.Fatalf("[%d]: DecryptInt(%v): %v != %d", m, y, x, i)
+			}
+		}
+		if m > 10 && identity == int(m) {
+			t.Fatalf("[%d]: EncryptInt: is the identity permutation", m)
+		}
+	}
+}
+
+func TestFPEInt(t *testing.T) {
+	f := newTestFPE(t)
+	defer f.Reset()
+
+	// When the modulus is a power of 256, no cycle-walking occurs, and
+	// the output is the enciphered big endian integer.
+	modulus := new(big.Int).Lsh(big.NewInt(1), 128)
+	x := new(big.Int).Sub(modulus, big.NewInt(12345))
+	y, err := f.EncryptInt(modulus, x, [][]byte{[]byte("tweak")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf [16]byte
+	copy(buf[16-len(x.Bytes()):], x.Bytes())
+	f.c.Encipher([][]byte{append([]byte("AEZ-FPE"), modulus.Bytes()...), []byte("tweak")}, buf[:], buf[:])
+	if y.Cmp(new(big.Int).SetBytes(buf[:])) != 0 {
+		t.Fatalf("EncryptInt: %v != %x", y, buf)
+	}
+
+	// Different tweaks and moduli give different permutations.
+	x = big.NewInt(1234567)
+	modulus = big.NewInt(100000000)
+	y0, _ := f.EncryptInt(modulus, x, nil)
+	y1, _ := f.EncryptInt(modulus, x, [][]byte{[]byte("tweak")})
+	y2, _ := f.EncryptInt(big.NewInt(100000001), x, nil)
+	if y0.Cmp(y1) == 0 || y0.Cmp(y2) == 0 {
+		t.Fatalf("EncryptInt: tweak/modulus not bound: %v %v %v", y0, y1, y2)
+	}
+
+	// Invalid domains and inputs are rejected.
+	if _, err = f.EncryptInt(big.NewInt(1), big.NewInt(0), nil); err != errInvalidFPEDomain {
+		t.Fatalf("EncryptInt: accepted invalid modulus: %v", err)
+	}
+	if _, err = f.EncryptInt(big.NewInt(10), big.NewInt(10), nil); err != errInvalidFPEInput {
+		t.Fatalf("EncryptInt: accepted x >= modulus: %v", err)
+	}
+	if _, err = f.DecryptInt(big.NewInt(10), big.NewInt(-1), nil); err != errInvalidFPEInput {
+		t.Fatalf("DecryptInt: accepted negative x: %v", err)
+	}
+}
+
+func TestFPEStringBijective(t *testing.T) {
+	f := newTestFPE(t)
+	defer f.Reset()
+
+	for _, v := range []struct {
+		alphabet string
+		n        int
+	}{
+		{DecimalAlphabet, 1},
+		{DecimalAlphabet, 2},
+		{"ab", 8},
+		{"αβγδε", 3},
+	} {
+		radix := len([]rune(v.alphabet))
+		seen := make(map[string]bool)
+
+		// Enumerate every string of length n over the alphabet.
+		idx := make([]int, v.n)
+		for {
+			in := make([]rune, v.n)
+			for i, j := range idx {
+				in[i] = []rune(v.alphabet)[j]
+			}
+			s := string(in)
+
+			c, err := f.EncryptString(v.alphabet, s, nil)
+			if err != nil {
+				t.Fatalf("[%s/%d]: EncryptString(%s): %v", v.alphabet, v.n, s, err)
+			}
+			if len([]rune(c)) != v.n {
+				t.Fatalf("[%s/%d]: EncryptString(%s): length changed: %s", v.alphabet, v.n, s, c)
+			}
+			for _, r := range c {
+				if !strings.ContainsRune(v.alphabet, r) {
+					t.Fatalf("[%s/%d]: EncryptString(%s): invalid output: %s", v.alphabet, v.n, s, c)
+				}
+			}
+			if seen[c] {
+				t.Fatalf("[%s/%d]: EncryptString(%s): collision: %s", v.alphabet, v.n, s, c)
+			}
+			seen[c] = true
+
+			p, err := f.DecryptString(v.alphabet, c, nil)
+			if err != nil {
+				t.Fatalf("[%s/%d]: DecryptString(%s): %v", v.alphabet, v.n, c, err)
+			}
+			if p != s {
+				t.Fatalf("[%s/%d]: DecryptString(%s): %s != %s", v.alphabet, v.n, c, p, s)
+			}
+
+			// Increment the index, finishing on overflow.
+			i := v.n - 1
+			for ; i >= 0; i-- {
+				if idx[i]++; idx[i] < radix {
+					break
+				}
+				idx[i] = 0
+			}
+			if i < 0 {
+				break
+			}
+		}
+	}
+}
+
+func TestFPEString(t *testing.T) {
+	f := newTestFPE(t)
+	defer f.Reset()
+
+	// Leading zeroes are preserved as part of the format.
+	acct := "0000123456789012"
+	c, err := f.EncryptString(DecimalAlphabet, acct, [][]byte{[]byte("bank")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != len(acct) || strings.Trim(c, DecimalAlphabet) != "" {
+		t.Fatalf("EncryptString: invalid output: %s", c)
+	}
+	p, err := f.DecryptString(DecimalAlphabet, c, [][]byte{[]byte("bank")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != acct {
+		t.Fatalf("DecryptString: %s != %s", p, acct)
+	}
+
+	// Invalid alphabets and inputs are rejected.
+	for _, alphabet := range []string{"", "a", "aab"} {
+		if _, err = f.EncryptString(alphabet, "a", nil); err != errInvalidFPEDomain {
+			t.Fatalf("EncryptString: accepted invalid alphabet '%s': %v", alphabet, err)
+		}
+	}
+	for _, s := range []string{"", "12a4"} {
+		if _, err = f.EncryptString(DecimalAlphabet, s, nil); err != errInvalidFPEInput {
+			t.Fatalf("EncryptString: accepted invalid input '%s': %v", s, err)
+		}
+	}
+}
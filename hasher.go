@@ -0,0 +1,184 @@
+// hasher.go - Incremental AEZ-hash of additional data.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+// ADHasher incrementally computes the AEZ-hash of a vector of additional
+// data, so that large additional data elements need not be held in memory.
+//
+// AEZ-hash is the XOR-sum of the enciphering of each 16 byte block of each
+// element, tweaked by the element's position in the vector, so each element
+// of the vector is written between a call to BeginComponent and a call to
+// EndComponent.  The result may be used with Cipher.EncryptWithHasher and
+// Cipher.DecryptWithHasher, such that:
+//
+//   h := c.NewADHasher()
+//   for _, v := range additionalData {
+//           h.BeginComponent()
+//           h.Write(v)
+//           h.EndComponent()
+//   }
+//   c.EncryptWithHasher(nonce, h, tau, plaintext, dst) == c.Encrypt(nonce, additionalData, tau, plaintext, dst)
+//
+// An ADHasher is bound to the Cipher that created it, and is not safe for
+// concurrent use by multiple goroutines.
+type ADHasher struct {
+	sum [blockSize]byte
+	J   [blockSize]byte
+	I   [blockSize]byte
+	buf [blockSize]byte
+
+	e           *eState
+	nBuf        int
+	i           uint
+	k           uint
+	inComponent bool
+}
+
+func (h *ADHasher) hashBlock(b []byte) {
+	var tmp [blockSize]byte
+
+	h.e.aes4(&h.J, &h.I, &h.e.L[h.i%8], b, &tmp) // E(5+k,i)
+	xorBytes1x16(h.sum[:], tmp[:], h.sum[:])
+	if h.i%8 == 0 {
+		doubleBlock(&h.I)
+	}
+	h.i++
+
+	memwipe(tmp[:])
+}
+
+// finalBlock accumulates the contribution of the final partial (or empty)
+// block of the current element into sum, without altering the state.
+func (h *ADHasher) finalBlock(sum *[blockSize]byte) {
+	var tmp [blockSize]byte
+
+	if h.nBuf > 0 || h.i == 1 {
+		copy(tmp[:], h.buf[:h.nBuf])
+		tmp[h.nBuf] = 0x80
+		h.e.aes4(&h.J, &h.e.I[0], &h.e.L[0], tmp[:], &tmp) // E(5+k,0)
+		xorBytes1x16(sum[:], tmp[:], sum[:])
+	}
+
+	memwipe(tmp[:])
+}
+
+// BeginComponent begins the next element of the additional data vector.
+func (h *ADHasher) BeginComponent() {
+	if h.inComponent {
+		panic("aez: ADHasher: BeginComponent called with a component in progress")
+	}
+
+	if h.k == 0 {
+		multBlock(5, &h.e.J[0], &h.J)
+	} else {
+		h.e.nextJ(4+h.k, &h.J)
+	}
+	copy(h.I[:], h.e.I[1][:])
+	h.i = 1
+	h.nBuf = 0
+	h.inComponent = true
+}
+
+// Write appends p to the current element of the additional data vector.  It
+// never returns an error.
+func (h *ADHasher) Write(p []byte) (int, error) {
+	if !h.inComponent {
+		panic("aez: ADHasher: Write called without a component in progress")
+	}
+	n := len(p)
+
+	// Complete a partially buffered block.
+	if h.nBuf > 0 {
+		copied := copy(h.buf[h.nBuf:], p)
+		h.nBuf += copied
+		p = p[copied:]
+		if h.nBuf < blockSize {
+			return n, nil
+		}
+		h.hashBlock(h.buf[:])
+		h.nBuf = 0
+	}
+
+	// Process full blocks directly from p.
+	for len(p) >= blockSize {
+		h.hashBlock(p[:blockSize])
+		p = p[blockSize:]
+	}
+
+	// Buffer any trailing partial block.
+	h.nBuf = copy(h.buf[:], p)
+
+	return n, nil
+}
+
+// EndComponent ends the current element of the additional data vector.
+func (h *ADHasher) EndComponent() {
+	if !h.inComponent {
+		panic("aez: ADHasher: EndComponent called without a component in progress")
+	}
+
+	h.finalBlock(&h.sum)
+	memwipe(h.buf[:])
+	h.nBuf = 0
+	h.k++
+	h.inComponent = false
+}
+
+// Reset resets the ADHasher to an empty additional data vector.
+func (h *ADHasher) Reset() {
+	memwipe(h.sum[:])
+	memwipe(h.J[:])
+	memwipe(h.I[:])
+	memwipe(h.buf[:])
+	h.nBuf = 0
+	h.i = 0
+	h.k = 0
+	h.inComponent = false
+}
+
+// delta returns the AEZ-hash of the tau, nonce and the additional data
+// vector absorbed by the ADHasher.
+func (h *ADHasher) delta(e *eState, nonce []byte, tau int, delta *[blockSize]byte) {
+	if h.e != e {
+		panic("aez: ADHasher used with a different Cipher")
+	}
+	if h.inComponent {
+		panic("aez: ADHasher used with a component in progress")
+	}
+
+	e.aezHash(nonce, nil, tau*8, delta[:])
+	xorBytes1x16(delta[:], h.sum[:], delta[:])
+}
+
+// NewADHasher returns a new ADHasher for use with the Cipher, with an empty
+// additional data vector.
+func (c *Cipher) NewADHasher() *ADHasher {
+	return &ADHasher{e: &c.e}
+}
+
+// EncryptWithHasher is Encrypt, with the additional data vector absorbed by
+// the ADHasher, which MUST have been created by the Cipher and MUST NOT have
+// a component in progress.  The ADHasher is not altered, and may be reused.
+func (c *Cipher) EncryptWithHasher(nonce []byte, h *ADHasher, tau int, plaintext, dst []byte) []byte {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	h.delta(&c.e, nonce, tau, &delta)
+	return c.e.encryptDelta(&delta, tau, plaintext, dst, 1)
+}
+
+// DecryptWithHasher is Decrypt, with the additional data vector absorbed by
+// the ADHasher, which MUST have been created by the Cipher and MUST NOT have
+// a component in progress.  The ADHasher is not altered, and may be reused.
+func (c *Cipher) DecryptWithHasher(nonce []byte, h *ADHasher, tau int, ciphertext, dst []byte) ([]byte, bool) {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	h.delta(&c.e, nonce, tau, &delta)
+	return c.e.decryptDelta(&delta, tau, ciphertext, dst, 1)
+}
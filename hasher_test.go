@@ -0,0 +1,120 @@
+// hasher_test.go - Incremental AEZ-hash of additional data tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"crypto/rand"
+	mrand "math/rand"
+	"testing"
+)
+
+func TestADHasher(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	rng := mrand.New(mrand.NewSource(0))
+	nonce := make([]byte, 16)
+	plaintext := make([]byte, 100)
+	rng.Read(nonce)
+	rng.Read(plaintext)
+
+	for i := 0; i < 100; i++ {
+		// Random additional data vector, with some empty elements.
+		ad := make([][]byte, rng.Intn(12))
+		for j := range ad {
+			if rng.Intn(4) != 0 {
+				ad[j] = make([]byte, rng.Intn(300))
+				rng.Read(ad[j])
+			}
+		}
+
+		// Absorb each element in randomly sized chunks.
+		h := c.NewADHasher()
+		for _, v := range ad {
+			h.BeginComponent()
+			for len(v) > 0 {
+				n := rng.Intn(len(v)) + 1
+				h.Write(v[:n])
+				v = v[n:]
+			}
+			h.EndComponent()
+		}
+
+		for _, tau := range []int{0, 1, 16} {
+			for _, pt := range [][]byte{nil, plaintext[:rng.Intn(len(plaintext))+1]} {
+				if tau == 0 && len(pt) == 0 {
+					continue
+				}
+				expected := c.Encrypt(nonce, ad, tau, pt, nil)
+				ct := c.EncryptWithHasher(nonce, h, tau, pt, nil)
+				assertEqual(t, i, expected, ct)
+
+				m, ok := c.DecryptWithHasher(nonce, h, tau, ct, nil)
+				if !ok {
+					t.Fatalf("[%d/%d]: DecryptWithHasher: rejected valid ciphertext", i, tau)
+				}
+				assertEqual(t, i, pt, m)
+
+				if tau == 16 {
+					ct[0] ^= 0x01
+					if _, ok = c.DecryptWithHasher(nonce, h, tau, ct, nil); ok {
+						t.Fatalf("[%d/%d]: DecryptWithHasher: accepted tampered ciphertext", i, tau)
+					}
+				}
+			}
+		}
+
+		// Reset returns the hasher to an empty vector.
+		h.Reset()
+		assertEqual(t, i, c.Encrypt(nonce, nil, 16, plaintext, nil), c.EncryptWithHasher(nonce, h, 16, plaintext, nil))
+	}
+}
+
+func TestADHasherMisuse(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+	c2, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Reset()
+
+	assertPanics := func(name string, fn func()) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("%s: did not panic", name)
+			}
+		}()
+		fn()
+	}
+
+	h := c.NewADHasher()
+	assertPanics("Write", func() { h.Write([]byte("foo")) })
+	assertPanics("EndComponent", func() { h.EndComponent() })
+	h.BeginComponent()
+	assertPanics("BeginComponent", func() { h.BeginComponent() })
+	assertPanics("EncryptWithHasher", func() { c.EncryptWithHasher(nil, h, 16, nil, nil) })
+	h.EndComponent()
+	assertPanics("EncryptWithHasher", func() { c2.EncryptWithHasher(nil, h, 16, nil, nil) })
+}
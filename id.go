@@ -0,0 +1,135 @@
+// id.go - Opaque 64 bit identifier encryption.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+const (
+	// IDTokenSize is the size of a token returned by
+	// IDCipher.EncryptUint64 in bytes.
+	IDTokenSize = 8
+
+	// IDTagSize is the size of the authentication tag appended to tokens
+	// by IDCipher.EncryptUint64Auth in bytes.
+	IDTagSize = 4
+
+	// IDAuthTokenSize is the size of a token returned by
+	// IDCipher.EncryptUint64Auth in bytes.
+	IDAuthTokenSize = IDTokenSize + IDTagSize
+)
+
+var (
+	errInvalidTokenSize = errors.New("aez: Invalid token size")
+
+	idBase32Encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+)
+
+// IDCipher encrypts 64 bit integer identifiers (eg: database row IDs) into
+// opaque tokens, such that they can be exposed publicly without revealing
+// the underlying value, or allowing other valid identifiers to be guessed.
+//
+// Identifiers are encrypted with a namespace (eg: the table name) as the
+// tweak, so that the same identifier in different namespaces results in
+// unrelated tokens, such that:
+//
+//   EncryptUint64(v, namespace) == Encrypt(key, namespace, nil, 0, uint64BE(v))
+//   EncryptUint64Auth(v, namespace) == Encrypt(key, namespace, nil, IDTagSize, uint64BE(v))
+//
+// The unauthenticated tokens are a permutation over all 8 byte values, so
+// every token decrypts to some identifier, and it is up to the caller to
+// reject identifiers that do not exist.  The authenticated tokens append an
+// IDTagSize byte tag, such that a forged token is rejected with probability
+// 1 - 2^-32.  Signed identifiers may be converted to and from uint64.
+type IDCipher struct {
+	c Cipher
+}
+
+// EncryptUint64 encrypts v under the provided namespace, returning a
+// IDTokenSize byte token.
+func (c *IDCipher) EncryptUint64(v uint64, namespace []byte) []byte {
+	var buf [IDTokenSize]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return c.c.e.encrypt(namespace, nil, 0, buf[:], make([]byte, 0, IDTokenSize))
+}
+
+// DecryptUint64 decrypts a token returned by EncryptUint64 with the same
+// namespace, returning the identifier.
+func (c *IDCipher) DecryptUint64(token, namespace []byte) (uint64, error) {
+	var buf [IDTokenSize]byte
+	if len(token) != IDTokenSize {
+		return 0, errInvalidTokenSize
+	}
+	v, _ := c.c.e.decrypt(namespace, nil, 0, token, buf[:0])
+	return binary.BigEndian.Uint64(v), nil
+}
+
+// EncryptUint64Auth encrypts and authenticates v under the provided
+// namespace, returning a IDAuthTokenSize byte token.
+func (c *IDCipher) EncryptUint64Auth(v uint64, namespace []byte) []byte {
+	var buf [IDTokenSize]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return c.c.e.encrypt(namespace, nil, IDTagSize, buf[:], make([]byte, 0, IDAuthTokenSize))
+}
+
+// DecryptUint64Auth decrypts and authenticates a token returned by
+// EncryptUint64Auth with the same namespace, returning the identifier.
+func (c *IDCipher) DecryptUint64Auth(token, namespace []byte) (uint64, error) {
+	var buf [IDAuthTokenSize]byte
+	if len(token) != IDAuthTokenSize {
+		return 0, errInvalidTokenSize
+	}
+	v, ok := c.c.e.decrypt(namespace, nil, IDTagSize, token, buf[:0])
+	if !ok {
+		return 0, errOpen
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+// Reset clears the sensitive keying material from the datastructure such
+// that it will no longer be in memory.
+func (c *IDCipher) Reset() {
+	c.c.Reset()
+}
+
+// NewIDCipher returns a new IDCipher instance keyed with the provided key.
+func NewIDCipher(key []byte) (*IDCipher, error) {
+	if len(key) == 0 {
+		return nil, errInvalidKeySize
+	}
+	c := new(IDCipher)
+	c.c.e.init(key)
+	return c, nil
+}
+
+// EncodeIDBase64 encodes a token with the URL-safe base64 alphabet, without
+// padding.
+func EncodeIDBase64(token []byte) string {
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// DecodeIDBase64 decodes a token encoded by EncodeIDBase64.
+func DecodeIDBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// EncodeIDBase32 encodes a token with the lower case base32 alphabet, without
+// padding.  The result is URL-safe and case-insensitive.
+func EncodeIDBase32(token []byte) string {
+	return idBase32Encoding.EncodeToString(token)
+}
+
+// DecodeIDBase32 decodes a token encoded by EncodeIDBase32, ignoring case.
+func DecodeIDBase32(s string) ([]byte, error) {
+	return idBase32Encoding.DecodeString(strings.ToLower(s))
+}
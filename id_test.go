@@ -0,0 +1,109 @@
+// id_test.go - Opaque 64 bit identifier encryption tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestIDCipher(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewIDCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	users, posts := []byte("users"), []byte("posts")
+	seen := make(map[string]bool)
+	for _, v := range []uint64{0, 1, 2, 42, 1 << 32, ^uint64(0)} {
+		var pt [8]byte
+		binary.BigEndian.PutUint64(pt[:], v)
+
+		// Unauthenticated.
+		token := c.EncryptUint64(v, users)
+		if len(token) != IDTokenSize {
+			t.Fatalf("[%d]: EncryptUint64: len(token) = %d", v, len(token))
+		}
+		assertEqual(t, 0, Encrypt(key[:], users, nil, 0, pt[:], nil), token)
+		if bytes.Equal(token, c.EncryptUint64(v, posts)) {
+			t.Fatalf("[%d]: EncryptUint64: namespace not bound", v)
+		}
+		if seen[string(token)] {
+			t.Fatalf("[%d]: EncryptUint64: collision", v)
+		}
+		seen[string(token)] = true
+
+		d, err := c.DecryptUint64(token, users)
+		if err != nil || d != v {
+			t.Fatalf("[%d]: DecryptUint64: %d %v", v, d, err)
+		}
+
+		// Authenticated.
+		token = c.EncryptUint64Auth(v, users)
+		if len(token) != IDAuthTokenSize {
+			t.Fatalf("[%d]: EncryptUint64Auth: len(token) = %d", v, len(token))
+		}
+		assertEqual(t, 0, Encrypt(key[:], users, nil, IDTagSize, pt[:], nil), token)
+
+		d, err = c.DecryptUint64Auth(token, users)
+		if err != nil || d != v {
+			t.Fatalf("[%d]: DecryptUint64Auth: %d %v", v, d, err)
+		}
+		if _, err = c.DecryptUint64Auth(token, posts); err != errOpen {
+			t.Fatalf("[%d]: DecryptUint64Auth: accepted wrong namespace: %v", v, err)
+		}
+		token[0] ^= 0x01
+		if _, err = c.DecryptUint64Auth(token, users); err != errOpen {
+			t.Fatalf("[%d]: DecryptUint64Auth: accepted tampered token: %v", v, err)
+		}
+	}
+
+	if _, err = c.DecryptUint64(make([]byte, IDTokenSize+1), users); err != errInvalidTokenSize {
+		t.Fatalf("DecryptUint64: accepted invalid token size: %v", err)
+	}
+	if _, err = c.DecryptUint64Auth(make([]byte, IDTokenSize), users); err != errInvalidTokenSize {
+		t.Fatalf("DecryptUint64Auth: accepted invalid token size: %v", err)
+	}
+}
+
+func TestIDEncoding(t *testing.T) {
+	token := []byte{0xfb, 0xff, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+
+	s := EncodeIDBase64(token)
+	if strings.ContainsAny(s, "+/=") {
+		t.Fatalf("EncodeIDBase64: not URL-safe: %s", s)
+	}
+	b, err := DecodeIDBase64(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 0, token, b)
+
+	s = EncodeIDBase32(token)
+	if s != strings.ToLower(s) || strings.Contains(s, "=") {
+		t.Fatalf("EncodeIDBase32: not lower case and unpadded: %s", s)
+	}
+	b, err = DecodeIDBase32(strings.ToUpper(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 0, token, b)
+
+	if _, err = DecodeIDBase32("!!"); err == nil {
+		t.Fatalf("DecodeIDBase32: accepted invalid input")
+	}
+}
@@ -0,0 +1,117 @@
+// mac.go - AEZ-hash based MAC.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"crypto/subtle"
+	"hash"
+)
+
+// MAC is AEZ used as a message authentication code, implementing hash.Hash.
+//
+// The tag of a message is the AEZ encryption of an empty plaintext, with an
+// empty nonce and the message as the sole additional data element, such
+// that:
+//
+//   Sum(nil) == Encrypt(key, nil, [][]byte{message}, tagSize, nil, nil)
+//
+// As AEZ-hash processes additional data in 16 byte blocks, the message is
+// absorbed incrementally as it is written, without being buffered.
+type MAC struct {
+	c Cipher
+	h ADHasher
+
+	// The tau and empty nonce contribution to AEZ-hash.
+	prefix [blockSize]byte
+
+	tagSize int
+}
+
+// Write adds more data to the running MAC.  It never returns an error.
+func (m *MAC) Write(p []byte) (int, error) {
+	return m.h.Write(p)
+}
+
+// Sum appends the current tag to b and returns the resulting slice.  It does
+// not change the underlying MAC state.
+func (m *MAC) Sum(b []byte) []byte {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	xorBytes1x16(m.prefix[:], m.h.sum[:], delta[:])
+	m.h.finalBlock(&delta)
+
+	off := len(b)
+	if cap(b)-off >= m.tagSize {
+		b = b[:off+m.tagSize]
+	} else {
+		x := make([]byte, off+m.tagSize)
+		copy(x, b)
+		b = x
+	}
+	m.c.e.aezPRF(&delta, m.tagSize, b[off:])
+
+	return b
+}
+
+// Verify returns true iff tag is the tag of the data written so far, in
+// constant time.  It does not change the underlying MAC state.
+func (m *MAC) Verify(tag []byte) bool {
+	expected := m.Sum(nil)
+	defer memwipe(expected)
+
+	return subtle.ConstantTimeCompare(expected, tag) == 1
+}
+
+// Reset resets the MAC to its initial state, per the hash.Hash interface.
+// To clear the sensitive keying material, use Wipe.
+func (m *MAC) Reset() {
+	m.h.Reset()
+	m.h.BeginComponent()
+}
+
+// Wipe clears the sensitive keying material and MAC state from the
+// datastructure such that it will no longer be in memory.  The MAC MUST NOT
+// be used after it has been wiped.
+func (m *MAC) Wipe() {
+	m.h.Reset()
+	m.c.Reset()
+	memwipe(m.prefix[:])
+}
+
+// Size returns the number of bytes Sum will append, which is the tag size.
+func (m *MAC) Size() int {
+	return m.tagSize
+}
+
+// BlockSize returns the MAC's underlying block size.
+func (m *MAC) BlockSize() int {
+	return blockSize
+}
+
+// NewMAC returns a new hash.Hash computing the AEZ MAC with the provided key
+// and tag size in bytes.  The returned hash.Hash is a *MAC, which
+// additionally provides constant time tag verification via Verify.
+func NewMAC(key []byte, tagSize int) (hash.Hash, error) {
+	if len(key) == 0 {
+		return nil, errInvalidKeySize
+	}
+	if tagSize < 1 || tagSize > maxTagSize {
+		return nil, errInvalidTagSize
+	}
+
+	m := &MAC{tagSize: tagSize}
+	m.c.e.init(key)
+	m.c.e.aezHash(nil, nil, tagSize*8, m.prefix[:])
+	m.h.e = &m.c.e
+	m.Reset()
+
+	return m, nil
+}
+
+var _ hash.Hash = (*MAC)(nil)
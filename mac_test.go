@@ -0,0 +1,82 @@
+// mac_test.go - AEZ-hash based MAC tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"crypto/rand"
+	mrand "math/rand"
+	"testing"
+)
+
+func TestMAC(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := make([]byte, 300)
+	if _, err := rand.Read(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	rng := mrand.New(mrand.NewSource(0))
+	for _, tagSize := range []int{1, 16, 32, 45} {
+		h, err := NewMAC(key[:], tagSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := h.(*MAC)
+		if h.Size() != tagSize || h.BlockSize() != blockSize {
+			t.Fatalf("[%d]: Size/BlockSize: %d %d", tagSize, h.Size(), h.BlockSize())
+		}
+
+		for sz := 0; sz <= len(msg); sz++ {
+			expected := Encrypt(key[:], nil, [][]byte{msg[:sz]}, tagSize, nil, nil)
+
+			// Write the message in randomly sized chunks, checking
+			// that Sum does not change the state as it goes.
+			h.Reset()
+			for p := msg[:sz]; len(p) > 0; {
+				n := rng.Intn(len(p)) + 1
+				h.Write(p[:n])
+				p = p[n:]
+				h.Sum(nil)
+			}
+
+			prefix := []byte("prefix")
+			tag := h.Sum(prefix[:len(prefix):len(prefix)])
+			assertEqual(t, sz, prefix, tag[:len(prefix)])
+			assertEqual(t, sz, expected, tag[len(prefix):])
+			assertEqual(t, sz, expected, h.Sum(nil))
+
+			if !m.Verify(expected) {
+				t.Fatalf("[%d/%d]: Verify: rejected valid tag", tagSize, sz)
+			}
+			if tagSize >= 4 {
+				expected[0] ^= 0x01
+				if m.Verify(expected) {
+					t.Fatalf("[%d/%d]: Verify: accepted invalid tag", tagSize, sz)
+				}
+			}
+			if m.Verify(expected[:tagSize-1]) {
+				t.Fatalf("[%d/%d]: Verify: accepted truncated tag", tagSize, sz)
+			}
+		}
+
+		m.Wipe()
+	}
+
+	for _, tagSize := range []int{-1, 0, maxTagSize + 1} {
+		if _, err := NewMAC(key[:], tagSize); err != errInvalidTagSize {
+			t.Fatalf("NewMAC: accepted tag size: %d", tagSize)
+		}
+	}
+	if _, err := NewMAC(nil, 16); err != errInvalidKeySize {
+		t.Fatalf("NewMAC: accepted empty key")
+	}
+}
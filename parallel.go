@@ -0,0 +1,143 @@
+// parallel.go - Multi-goroutine AEZ-core.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import "sync"
+
+const (
+	// segmentAlign is the granularity at which the AEZ-core passes are
+	// split, such that each segment begins at a block pair index i where
+	// i%8 == 1, with the corresponding doubling of I.
+	segmentAlign = 8 * 2 * blockSize
+
+	// minSegmentSize is the smallest segment of an AEZ-core pass that will
+	// be handed to a separate goroutine.
+	minSegmentSize = 32 * 1024
+)
+
+type coreSegment struct {
+	I   [blockSize]byte
+	sum [blockSize]byte
+	off int
+	sz  int
+}
+
+// coreSegments splits a sz byte AEZ-core pass into at most workers segments,
+// along with the initial I of each segment.
+func (e *eState) coreSegments(sz, workers int) []coreSegment {
+	var I [blockSize]byte
+
+	if n := sz / minSegmentSize; workers > n {
+		workers = n
+	}
+	segSz := (sz/workers + segmentAlign - 1) / segmentAlign * segmentAlign
+
+	segs := make([]coreSegment, 0, workers)
+	copy(I[:], e.I[1][:])
+	for off := 0; off < sz; off += segSz {
+		s := coreSegment{off: off, sz: sz - off}
+		if s.sz > segSz {
+			s.sz = segSz
+		}
+		copy(s.I[:], I[:])
+		segs = append(segs, s)
+
+		for i := 0; i < segSz/segmentAlign; i++ {
+			doubleBlock(&I)
+		}
+	}
+
+	memwipe(I[:])
+	return segs
+}
+
+func wipeSegments(segs []coreSegment) {
+	for i := range segs {
+		memwipe(segs[i].I[:])
+		memwipe(segs[i].sum[:])
+	}
+}
+
+func (e *eState) aezCorePass1Parallel(in, out []byte, X *[blockSize]byte, sz, workers int) {
+	if workers < 2 || sz < 2*minSegmentSize {
+		e.aezCorePass1(in, out, X, &e.I[1], sz)
+		return
+	}
+
+	segs := e.coreSegments(sz, workers)
+	defer wipeSegments(segs)
+
+	var wg sync.WaitGroup
+	wg.Add(len(segs))
+	for i := range segs {
+		go func(s *coreSegment) {
+			defer wg.Done()
+			e.aezCorePass1(in[s.off:], out[s.off:], &s.sum, &s.I, s.sz)
+		}(&segs[i])
+	}
+	wg.Wait()
+
+	// X is the sum over all of the segments.
+	for i := range segs {
+		xorBytes1x16(X[:], segs[i].sum[:], X[:])
+	}
+}
+
+func (e *eState) aezCorePass2Parallel(in, out []byte, Y, S *[blockSize]byte, sz, workers int) {
+	if workers < 2 || sz < 2*minSegmentSize {
+		e.aezCorePass2(in, out, Y, S, &e.I[1], sz)
+		return
+	}
+
+	// Copy S, so that it only ends up on the heap when this path is taken.
+	var sCopy [blockSize]byte
+	copy(sCopy[:], S[:])
+	defer memwipe(sCopy[:])
+
+	segs := e.coreSegments(sz, workers)
+	defer wipeSegments(segs)
+
+	var wg sync.WaitGroup
+	wg.Add(len(segs))
+	for i := range segs {
+		go func(s *coreSegment) {
+			defer wg.Done()
+			e.aezCorePass2(in[s.off:], out[s.off:], &s.sum, &sCopy, &s.I, s.sz)
+		}(&segs[i])
+	}
+	wg.Wait()
+
+	// Y is the sum over all of the segments.
+	for i := range segs {
+		xorBytes1x16(Y[:], segs[i].sum[:], Y[:])
+	}
+}
+
+// EncryptParallel is Encrypt, with the processing of large plaintexts split
+// across up to workers goroutines.  The output is identical to that of
+// Encrypt, and plaintexts that are too small to benefit are processed by the
+// calling goroutine.
+func (c *Cipher) EncryptParallel(nonce []byte, additionalData [][]byte, tau int, plaintext, dst []byte, workers int) []byte {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	c.e.aezHash(nonce, additionalData, tau*8, delta[:])
+	return c.e.encryptDelta(&delta, tau, plaintext, dst, workers)
+}
+
+// DecryptParallel is Decrypt, with the processing of large ciphertexts split
+// across up to workers goroutines.  The output is identical to that of
+// Decrypt, and ciphertexts that are too small to benefit are processed by
+// the calling goroutine.
+func (c *Cipher) DecryptParallel(nonce []byte, additionalData [][]byte, tau int, ciphertext, dst []byte, workers int) ([]byte, bool) {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	c.e.aezHash(nonce, additionalData, tau*8, delta[:])
+	return c.e.decryptDelta(&delta, tau, ciphertext, dst, workers)
+}
@@ -0,0 +1,95 @@
+// parallel_test.go - Multi-goroutine AEZ-core tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"crypto/rand"
+	mrand "math/rand"
+	"runtime"
+	"testing"
+)
+
+func TestEncryptParallel(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	rng := mrand.New(mrand.NewSource(0))
+	nonce := make([]byte, 16)
+	ad := [][]byte{[]byte("additional data")}
+	rng.Read(nonce)
+
+	for i, sz := range []int{100, 64*1024 + 16, 100*1024 + 5, 300*1024 + 100} {
+		plaintext := make([]byte, sz)
+		rng.Read(plaintext)
+
+		expected := c.Encrypt(nonce, ad, 16, plaintext, nil)
+		for _, workers := range []int{0, 1, 2, 3, 7} {
+			ct := c.EncryptParallel(nonce, ad, 16, plaintext, nil, workers)
+			assertEqual(t, i, expected, ct)
+
+			m, ok := c.DecryptParallel(nonce, ad, 16, ct, nil, workers)
+			if !ok {
+				t.Fatalf("[%d/%d]: DecryptParallel: rejected valid ciphertext", i, workers)
+			}
+			assertEqual(t, i, plaintext, m)
+
+			ct[len(ct)/2] ^= 0x01
+			if _, ok = c.DecryptParallel(nonce, ad, 16, ct, nil, workers); ok {
+				t.Fatalf("[%d/%d]: DecryptParallel: accepted tampered ciphertext", i, workers)
+			}
+		}
+	}
+}
+
+func doBenchEncryptParallel(b *testing.B, n, workers int) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		b.Fatal(err)
+	}
+
+	const tau = 16
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Reset()
+
+	var nonce [16]byte
+	src := make([]byte, n)
+	dst := make([]byte, n+tau)
+
+	b.SetBytes(int64(n))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst = c.EncryptParallel(nonce[:], nil, tau, src, dst[:0], workers)
+	}
+}
+
+func BenchmarkEncryptParallel(b *testing.B) {
+	sizes := []struct {
+		n    string
+		size int
+	}{
+		{"1MiB", 1024 * 1024},
+		{"16MiB", 16 * 1024 * 1024},
+	}
+
+	for _, sz := range sizes {
+		b.Run("Serial/"+sz.n, func(b *testing.B) { doBenchEncryptParallel(b, sz.size, 1) })
+		b.Run("NumCPU/"+sz.n, func(b *testing.B) { doBenchEncryptParallel(b, sz.size, runtime.NumCPU()) })
+	}
+}
@@ -0,0 +1,78 @@
+// prefix.go - Precomputed additional data prefixes.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+// ADPrefix is the precomputed AEZ-hash of the leading elements of an
+// additional data vector, for use when the leading elements are static (eg:
+// a protocol and channel identifier), and only the remaining elements vary
+// per message (eg: a sequence number).
+//
+// As AEZ-hash accumulates the contribution of each element independently, the
+// static elements only need to be hashed once, such that:
+//
+//   prefix := c.PrecomputeAD(protocolID, channelID)
+//   c.EncryptWithPrefix(nonce, prefix, [][]byte{seq}, tau, plaintext, dst) == c.Encrypt(nonce, [][]byte{protocolID, channelID, seq}, tau, plaintext, dst)
+//
+// An ADPrefix is bound to the Cipher that created it, and is immutable, so it
+// is safe for concurrent use by multiple goroutines.
+type ADPrefix struct {
+	e   *eState
+	sum [blockSize]byte
+	k   uint
+}
+
+// Reset clears the precomputed hash from the datastructure such that it will
+// no longer be in memory.  The ADPrefix MUST NOT be used after it has been
+// reset.
+func (p *ADPrefix) Reset() {
+	memwipe(p.sum[:])
+	p.e = nil
+}
+
+func (p *ADPrefix) delta(e *eState, nonce []byte, additionalData [][]byte, tau int, delta *[blockSize]byte) {
+	if p.e != e {
+		panic("aez: ADPrefix used with a different Cipher")
+	}
+
+	e.aezHash(nonce, nil, tau*8, delta[:])
+	xorBytes1x16(delta[:], p.sum[:], delta[:])
+	e.aezHashAD(additionalData, p.k, delta)
+}
+
+// PrecomputeAD returns the precomputed AEZ-hash of the provided leading
+// elements of an additional data vector.
+func (c *Cipher) PrecomputeAD(components ...[]byte) *ADPrefix {
+	p := &ADPrefix{
+		e: &c.e,
+		k: uint(len(components)),
+	}
+	c.e.aezHashAD(components, 0, &p.sum)
+	return p
+}
+
+// EncryptWithPrefix is Encrypt, with an additional data vector consisting of
+// the elements precomputed in the ADPrefix followed by the elements of
+// additionalData.  The ADPrefix MUST have been created by the Cipher.
+func (c *Cipher) EncryptWithPrefix(nonce []byte, prefix *ADPrefix, additionalData [][]byte, tau int, plaintext, dst []byte) []byte {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	prefix.delta(&c.e, nonce, additionalData, tau, &delta)
+	return c.e.encryptDelta(&delta, tau, plaintext, dst, 1)
+}
+
+// DecryptWithPrefix is Decrypt, with an additional data vector consisting of
+// the elements precomputed in the ADPrefix followed by the elements of
+// additionalData.  The ADPrefix MUST have been created by the Cipher.
+func (c *Cipher) DecryptWithPrefix(nonce []byte, prefix *ADPrefix, additionalData [][]byte, tau int, ciphertext, dst []byte) ([]byte, bool) {
+	var delta [blockSize]byte
+	defer memwipe(delta[:])
+
+	prefix.delta(&c.e, nonce, additionalData, tau, &delta)
+	return c.e.decryptDelta(&delta, tau, ciphertext, dst, 1)
+}
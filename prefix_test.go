@@ -0,0 +1,121 @@
+// prefix_test.go - Precomputed additional data prefix tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestADPrefix(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	var nonce [16]byte
+	plaintext := []byte("This is a test of the emergency broadcast system.")
+	protocolID := []byte("example protocol v1")
+	channelID := make([]byte, 300)
+	if _, err = rand.Read(channelID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		prefix [][]byte
+		rest   [][]byte
+	}{
+		{nil, nil},
+		{nil, [][]byte{protocolID}},
+		{[][]byte{protocolID}, nil},
+		{[][]byte{protocolID, channelID}, [][]byte{[]byte("seq")}},
+		{[][]byte{{}, protocolID, {}}, [][]byte{{}, channelID}},
+		{[][]byte{protocolID, channelID, protocolID, channelID, protocolID, channelID}, [][]byte{protocolID, channelID, protocolID}},
+	} {
+		p := c.PrecomputeAD(v.prefix...)
+		ad := append(append([][]byte{}, v.prefix...), v.rest...)
+
+		for _, tau := range []int{0, 16} {
+			expected := c.Encrypt(nonce[:], ad, tau, plaintext, nil)
+			ct := c.EncryptWithPrefix(nonce[:], p, v.rest, tau, plaintext, nil)
+			assertEqual(t, len(ad), expected, ct)
+
+			m, ok := c.DecryptWithPrefix(nonce[:], p, v.rest, tau, ct, nil)
+			if !ok {
+				t.Fatalf("[%d/%d]: DecryptWithPrefix: rejected valid ciphertext", len(ad), tau)
+			}
+			assertEqual(t, len(ad), plaintext, m)
+		}
+
+		// The prefix elements are not interchangeable with the rest.
+		if len(v.prefix) > 0 && len(v.rest) > 0 {
+			ct := c.Encrypt(nonce[:], append(v.rest, v.prefix...), 16, plaintext, nil)
+			if _, ok := c.DecryptWithPrefix(nonce[:], p, v.rest, 16, ct, nil); ok {
+				t.Fatalf("[%d]: DecryptWithPrefix: accepted reordered additional data", len(ad))
+			}
+		}
+
+		p.Reset()
+	}
+}
+
+func doBenchADPrefix(b *testing.B, n int, precompute bool) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		b.Fatal(err)
+	}
+
+	const tau = 16
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Reset()
+
+	var nonce [16]byte
+	protocolID := []byte("example protocol v1")
+	channelID := make([]byte, 32)
+	var seq [8]byte
+	src := make([]byte, n)
+	dst := make([]byte, n+tau)
+
+	p := c.PrecomputeAD(protocolID, channelID)
+	defer p.Reset()
+	ad := [][]byte{protocolID, channelID, seq[:]}
+	rest := [][]byte{seq[:]}
+
+	b.SetBytes(int64(n))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		binary.BigEndian.PutUint64(seq[:], uint64(i))
+		if precompute {
+			dst = c.EncryptWithPrefix(nonce[:], p, rest, tau, src, dst[:0])
+		} else {
+			dst = c.Encrypt(nonce[:], ad, tau, src, dst[:0])
+		}
+	}
+}
+
+func BenchmarkADPrefix(b *testing.B) {
+	sizes := []int{1, 64, 512, 1024}
+
+	for _, sz := range sizes {
+		n := fmt.Sprintf("%d", sz)
+		b.Run("Encrypt/"+n, func(b *testing.B) { doBenchADPrefix(b, sz, false) })
+		b.Run("EncryptWithPrefix/"+n, func(b *testing.B) { doBenchADPrefix(b, sz, true) })
+	}
+}
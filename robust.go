@@ -0,0 +1,108 @@
+// robust.go - Robust authenticated encryption.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import "crypto/subtle"
+
+// RedundancyFunc is an application supplied predicate that decides if a
+// deciphered plaintext is authentic, based on redundancy present in the
+// plaintext itself (eg: magic numbers, checksums, or reserved fields).
+//
+// The level of authenticity provided is determined by the amount of
+// redundancy checked, as a forgery will be accepted with probability of
+// approximately 2^-b where b is the number of bits of redundancy.  For
+// best results the predicate should execute in constant time.
+type RedundancyFunc func(plaintext []byte) bool
+
+// FixedBytes returns a RedundancyFunc that accepts plaintexts where the
+// bytes starting at offset are equal to value.  The comparison is done in
+// constant time.
+func FixedBytes(offset int, value []byte) RedundancyFunc {
+	if offset < 0 {
+		panic("aez: negative offset given to FixedBytes")
+	}
+	v := append([]byte{}, value...)
+
+	return func(plaintext []byte) bool {
+		if len(plaintext) < offset+len(v) {
+			return false
+		}
+		return subtle.ConstantTimeCompare(plaintext[offset:offset+len(v)], v) == 1
+	}
+}
+
+// AllOf returns a RedundancyFunc that accepts plaintexts iff all of the
+// provided predicates accept the plaintext.  Every predicate is always
+// evaluated.
+func AllOf(fns ...RedundancyFunc) RedundancyFunc {
+	return func(plaintext []byte) bool {
+		ok := true
+		for _, fn := range fns {
+			ok = fn(plaintext) && ok
+		}
+		return ok
+	}
+}
+
+func (e *eState) decryptRobust(nonce []byte, additionalData [][]byte, ciphertext, dst []byte, isValid RedundancyFunc) ([]byte, bool) {
+	dstSz := len(dst)
+
+	// With a tau of 0, the deciphered plaintext is always returned.
+	dst, _ = e.decryptUnverified(nonce, additionalData, 0, ciphertext, dst)
+	if !isValid(dst[dstSz:]) {
+		memwipe(dst[dstSz:])
+		return nil, false
+	}
+	return dst, true
+}
+
+// EncryptRobust encrypts the plaintext with a tau of 0, authenticates the
+// additional data, and appends the result to dst, returning the updated
+// slice.  No ciphertext expansion occurs, and the authenticity of the
+// ciphertext is derived entirely from redundancy present in the plaintext,
+// which is checked by DecryptRobust.  The plaintext and dst slices may
+// overlap, and plaintext[:0] may be used as dst to encrypt in place.
+func EncryptRobust(key []byte, nonce []byte, additionalData [][]byte, plaintext, dst []byte) []byte {
+	var e eState
+	defer e.reset()
+
+	e.init(key)
+	return e.encrypt(nonce, additionalData, 0, plaintext, dst)
+}
+
+// DecryptRobust decrypts the ciphertext with a tau of 0, and if the plaintext
+// is accepted by isValid, appends the resulting plaintext to the provided
+// slice and returns the updated slice and true.  The ciphertext and dst
+// slices may overlap, and ciphertext[:0] may be used as dst to decrypt in
+// place.
+func DecryptRobust(key []byte, nonce []byte, additionalData [][]byte, ciphertext, dst []byte, isValid RedundancyFunc) ([]byte, bool) {
+	var e eState
+	defer e.reset()
+
+	e.init(key)
+	return e.decryptRobust(nonce, additionalData, ciphertext, dst, isValid)
+}
+
+// EncryptRobust encrypts the plaintext with a tau of 0, authenticates the
+// additional data, and appends the result to dst, returning the updated
+// slice.  No ciphertext expansion occurs, and the authenticity of the
+// ciphertext is derived entirely from redundancy present in the plaintext,
+// which is checked by DecryptRobust.  The plaintext and dst slices may
+// overlap, and plaintext[:0] may be used as dst to encrypt in place.
+func (c *Cipher) EncryptRobust(nonce []byte, additionalData [][]byte, plaintext, dst []byte) []byte {
+	return c.e.encrypt(nonce, additionalData, 0, plaintext, dst)
+}
+
+// DecryptRobust decrypts the ciphertext with a tau of 0, and if the plaintext
+// is accepted by isValid, appends the resulting plaintext to the provided
+// slice and returns the updated slice and true.  The ciphertext and dst
+// slices may overlap, and ciphertext[:0] may be used as dst to decrypt in
+// place.
+func (c *Cipher) DecryptRobust(nonce []byte, additionalData [][]byte, ciphertext, dst []byte, isValid RedundancyFunc) ([]byte, bool) {
+	return c.e.decryptRobust(nonce, additionalData, ciphertext, dst, isValid)
+}
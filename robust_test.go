@@ -0,0 +1,96 @@
+// robust_test.go - Robust AE tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func TestRobust(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Reset()
+
+	magic := []byte("AEZR")
+	isValid := AllOf(FixedBytes(0, magic), FixedBytes(20, make([]byte, 4)))
+
+	var nonce [16]byte
+	ad := [][]byte{[]byte("record header")}
+	for _, sz := range []int{24, 31, 32, 33, 100, 1024} {
+		plaintext := make([]byte, sz)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		copy(plaintext, magic)
+		copy(plaintext[20:], make([]byte, 4))
+
+		ct := c.EncryptRobust(nonce[:], ad, plaintext, nil)
+		if len(ct) != sz {
+			t.Fatalf("[%d]: EncryptRobust expanded the ciphertext: %d", sz, len(ct))
+		}
+		assertEqual(t, sz, EncryptRobust(key[:], nonce[:], ad, plaintext, nil), ct)
+		assertEqual(t, sz, Encrypt(key[:], nonce[:], ad, 0, plaintext, nil), ct)
+
+		m, ok := c.DecryptRobust(nonce[:], ad, ct, nil, isValid)
+		if !ok {
+			t.Fatalf("[%d]: DecryptRobust failed", sz)
+		}
+		assertEqual(t, sz, plaintext, m)
+		m, ok = DecryptRobust(key[:], nonce[:], ad, ct, nil, isValid)
+		if !ok {
+			t.Fatalf("[%d]: DecryptRobust (one-shot) failed", sz)
+		}
+		assertEqual(t, sz, plaintext, m)
+
+		// Any modification to the ciphertext scrambles the entire
+		// plaintext, including the redundancy.
+		ct[sz/2] ^= 0x01
+		buf := make([]byte, 0, sz+7)
+		if _, ok = c.DecryptRobust(nonce[:], ad, ct, buf, isValid); ok {
+			t.Fatalf("[%d]: DecryptRobust accepted corrupted ciphertext", sz)
+		}
+		assertEqual(t, sz, make([]byte, cap(buf)), buf[:cap(buf)])
+		ct[sz/2] ^= 0x01
+		if _, ok = c.DecryptRobust(nonce[:], nil, ct, nil, isValid); ok {
+			t.Fatalf("[%d]: DecryptRobust accepted incorrect additional data", sz)
+		}
+	}
+}
+
+func TestFixedBytes(t *testing.T) {
+	f := FixedBytes(2, []byte{0xde, 0xad})
+	for _, v := range []struct {
+		b  []byte
+		ok bool
+	}{
+		{[]byte{0x00, 0x00, 0xde, 0xad}, true},
+		{[]byte{0x00, 0x00, 0xde, 0xad, 0x00}, true},
+		{[]byte{0x00, 0x00, 0xde, 0xae}, false},
+		{[]byte{0x00, 0x00, 0xde}, false},
+		{nil, false},
+	} {
+		if f(v.b) != v.ok {
+			t.Fatalf("FixedBytes(%x) != %v", v.b, v.ok)
+		}
+	}
+
+	if !AllOf()(nil) {
+		t.Fatalf("AllOf(): rejected input")
+	}
+	if AllOf(f, FixedBytes(0, []byte{0x01}))([]byte{0x00, 0x00, 0xde, 0xad}) {
+		t.Fatalf("AllOf: accepted input rejected by a predicate")
+	}
+}
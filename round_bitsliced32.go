@@ -76,6 +76,25 @@ func (r *roundB32) AES10(l *[blockSize]byte, src []byte, dst *[blockSize]byte) {
 	memwipeU32(q[:])
 }
 
+func (r *roundB32) aes10x2(l *[blockSize]byte,
+	src0 []byte, dst0 *[blockSize]byte,
+	src1 []byte, dst1 *[blockSize]byte) {
+	var q [8]uint32
+	xorBytes1x16(src0, l[:], dst0[:])
+	xorBytes1x16(src1, l[:], dst1[:])
+
+	ct32.Load8xU32(&q, dst0[:], dst1[:])
+	for i := 0; i < 3; i++ {
+		r.round(&q, r.skey[0:])  // I
+		r.round(&q, r.skey[8:])  // J
+		r.round(&q, r.skey[16:]) // L
+	}
+	r.round(&q, r.skey[0:]) // I
+	ct32.Store8xU32(dst0[:], dst1[:], &q)
+
+	memwipeU32(q[:])
+}
+
 func (r *roundB32) round(q *[8]uint32, k []uint32) {
 	ct32.Sbox(q)
 	ct32.ShiftRows(q)
@@ -83,10 +102,10 @@ func (r *roundB32) round(q *[8]uint32, k []uint32) {
 	ct32.AddRoundKey(q, k)
 }
 
-func (r *roundB32) aezCorePass1(e *eState, in, out []byte, X *[blockSize]byte, sz int) {
+func (r *roundB32) aezCorePass1(e *eState, in, out []byte, X, initialI *[blockSize]byte, sz int) {
 	var tmp0, tmp1, I [blockSize]byte
 
-	copy(I[:], e.I[1][:])
+	copy(I[:], initialI[:])
 	i := 1
 
 	// Process 4 * 16 bytes at a time in a loop.
@@ -124,10 +143,10 @@ func (r *roundB32) aezCorePass1(e *eState, in, out []byte, X *[blockSize]byte, s
 	memwipe(I[:])
 }
 
-func (r *roundB32) aezCorePass2(e *eState, out []byte, Y, S *[blockSize]byte, sz int) {
+func (r *roundB32) aezCorePass2(e *eState, out []byte, Y, S, initialI *[blockSize]byte, sz int) {
 	var tmp0, tmp1, I [blockSize]byte
 
-	copy(I[:], e.I[1][:])
+	copy(I[:], initialI[:])
 	i := 1
 
 	// Process 4 * 16 bytes at a time in a loop.
@@ -181,6 +200,103 @@ func (r *roundB32) aezCorePass2(e *eState, out []byte, Y, S *[blockSize]byte, sz
 	memwipe(I[:])
 }
 
+func (r *roundB32) aezHashBlocks(e *eState, J *[blockSize]byte, in []byte, sum *[blockSize]byte) {
+	var tmp0, tmp1, I [blockSize]byte
+
+	copy(I[:], e.I[1][:])
+	i := 1
+
+	// Process 2 * 16 bytes at a time in a loop.
+	for len(in) >= 2*blockSize {
+		r.aes4x2(J, &I, &e.L[(i+0)%8], in[:], &tmp0,
+			J, &I, &e.L[(i+1)%8], in[blockSize:], &tmp1) // E(J,i), E(J,i+1)
+		xorBytes1x16(sum[:], tmp0[:], sum[:])
+		xorBytes1x16(sum[:], tmp1[:], sum[:])
+
+		in = in[32:]
+		if (i+1)%8 == 0 {
+			doubleBlock(&I)
+		}
+		i += 2
+	}
+	if len(in) >= blockSize {
+		r.AES4(J, &I, &e.L[i%8], in[:], &tmp0) // E(J,i)
+		xorBytes1x16(sum[:], tmp0[:], sum[:])
+	}
+
+	memwipe(tmp0[:])
+	memwipe(tmp1[:])
+	memwipe(I[:])
+}
+
+func (r *roundB32) aezPRF(e *eState, delta *[blockSize]byte, tau int, result []byte) {
+	var ctr, src0, src1, tmp0, tmp1 [blockSize]byte
+	var buf [2 * blockSize]byte
+
+	// Process 2 * 16 bytes at a time in a loop, with the remaining 1 or 2
+	// blocks (where the final block may be partial) in the last pass.
+	for off := 0; off < tau; off += 2 * blockSize {
+		xorBytes1x16(delta[:], ctr[:], src0[:])
+		incrementCounter(&ctr)
+		xorBytes1x16(delta[:], ctr[:], src1[:])
+		incrementCounter(&ctr)
+
+		r.aes10x2(&e.L[3], src0[:], &tmp0,
+			src1[:], &tmp1) // E(-1,3) x2
+		copy(buf[:], tmp0[:])
+		copy(buf[blockSize:], tmp1[:])
+		copy(result[off:tau], buf[:])
+	}
+
+	memwipe(src0[:])
+	memwipe(src1[:])
+	memwipe(tmp0[:])
+	memwipe(tmp1[:])
+	memwipe(buf[:])
+}
+
+func (r *roundB32) aes4Blocks(buf []byte) {
+	var tmp0, tmp1 [blockSize]byte
+
+	// Process 2 * 16 bytes at a time in a loop.
+	for len(buf) >= 2*blockSize {
+		r.aes4x2(&zero, &zero, &zero, buf[:], &tmp0,
+			&zero, &zero, &zero, buf[blockSize:], &tmp1)
+		copy(buf[:], tmp0[:])
+		copy(buf[blockSize:], tmp1[:])
+
+		buf = buf[32:]
+	}
+	if len(buf) >= blockSize {
+		r.AES4(&zero, &zero, &zero, buf[:], &tmp0)
+		copy(buf[:], tmp0[:])
+	}
+
+	memwipe(tmp0[:])
+	memwipe(tmp1[:])
+}
+
+func (r *roundB32) aes10Blocks(buf []byte) {
+	var tmp0, tmp1 [blockSize]byte
+
+	// Process 2 * 16 bytes at a time in a loop.
+	for len(buf) >= 2*blockSize {
+		r.aes10x2(&zero, buf[:], &tmp0,
+			buf[blockSize:], &tmp1)
+		copy(buf[:], tmp0[:])
+		copy(buf[blockSize:], tmp1[:])
+
+		buf = buf[32:]
+	}
+	if len(buf) >= blockSize {
+		r.AES10(&zero, buf[:], &tmp0)
+		copy(buf[:], tmp0[:])
+	}
+
+	memwipe(tmp0[:])
+	memwipe(tmp1[:])
+}
+
 func memwipeU32(b []uint32) {
 	for i := range b {
 		b[i] = 0
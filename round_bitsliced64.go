@@ -77,6 +77,29 @@ func (r *roundB64) AES10(l *[blockSize]byte, src []byte, dst *[blockSize]byte) {
 	memwipeU64(q[:])
 }
 
+func (r *roundB64) aes10x4(l *[blockSize]byte,
+	src0 []byte, dst0 *[blockSize]byte,
+	src1 []byte, dst1 *[blockSize]byte,
+	src2 []byte, dst2 *[blockSize]byte,
+	src3 []byte, dst3 *[blockSize]byte) {
+	var q [8]uint64
+	xorBytes1x16(src0, l[:], dst0[:])
+	xorBytes1x16(src1, l[:], dst1[:])
+	xorBytes1x16(src2, l[:], dst2[:])
+	xorBytes1x16(src3, l[:], dst3[:])
+
+	ct64.Load16xU32(&q, dst0[:], dst1[:], dst2[:], dst3[:])
+	for i := 0; i < 3; i++ {
+		r.round(&q, r.skey[0:])  // I
+		r.round(&q, r.skey[8:])  // J
+		r.round(&q, r.skey[16:]) // L
+	}
+	r.round(&q, r.skey[0:]) // I
+	ct64.Store16xU32(dst0[:], dst1[:], dst2[:], dst3[:], &q)
+
+	memwipeU64(q[:])
+}
+
 func (r *roundB64) round(q *[8]uint64, k []uint64) {
 	ct64.Sbox(q)
 	ct64.ShiftRows(q)
@@ -84,10 +107,10 @@ func (r *roundB64) round(q *[8]uint64, k []uint64) {
 	ct64.AddRoundKey(q, k)
 }
 
-func (r *roundB64) aezCorePass1(e *eState, in, out []byte, X *[blockSize]byte, sz int) {
+func (r *roundB64) aezCorePass1(e *eState, in, out []byte, X, initialI *[blockSize]byte, sz int) {
 	var tmp0, tmp1, tmp2, tmp3, I [blockSize]byte
 
-	copy(I[:], e.I[1][:])
+	copy(I[:], initialI[:])
 	i := 1
 
 	// Process 8 * 16 bytes at a time in a loop.
@@ -123,21 +146,37 @@ func (r *roundB64) aezCorePass1(e *eState, in, out []byte, X *[blockSize]byte, s
 		i += 4
 	}
 
-	// XXX/performance: 4 * 16 bytes at a time.
+	// Process the remaining 1 to 3 * 32 bytes at once, discarding the
+	// unused lanes.
+	if n := sz / (2 * blockSize); n > 0 {
+		off1, off2 := laneOffsets(n, 2*blockSize)
 
-	for sz > 0 {
-		r.AES4(&e.J[0], &I, &e.L[i%8], in[blockSize:], &tmp0) // E(1,i)
+		r.aes4x4(&e.J[0], &I, &e.L[(i+0)%8], in[blockSize:], &tmp0,
+			&e.J[0], &I, &e.L[(i+1)%8], in[off1+blockSize:], &tmp1,
+			&e.J[0], &I, &e.L[(i+2)%8], in[off2+blockSize:], &tmp2,
+			&zero, &zero, &zero, in[blockSize:], &tmp3) // E(1,i) ... E(1,i+2)
 		xorBytes1x16(in[:], tmp0[:], out[:])
-		r.AES4(&zero, &e.I[0], &e.L[0], out[:], &tmp0) // E(0,0)
+		if n > 1 {
+			xorBytes1x16(in[off1:], tmp1[:], out[off1:])
+		}
+		if n > 2 {
+			xorBytes1x16(in[off2:], tmp2[:], out[off2:])
+		}
+
+		r.aes4x4(&zero, &e.I[0], &e.L[0], out[:], &tmp0,
+			&zero, &e.I[0], &e.L[0], out[off1:], &tmp1,
+			&zero, &e.I[0], &e.L[0], out[off2:], &tmp2,
+			&zero, &zero, &zero, out[:], &tmp3) // E(0,0) x3
 		xorBytes1x16(in[blockSize:], tmp0[:], out[blockSize:])
 		xorBytes1x16(out[blockSize:], X[:], X[:])
-
-		sz -= 2 * blockSize
-		in, out = in[32:], out[32:]
-		if i%8 == 0 {
-			doubleBlock(&I)
+		if n > 1 {
+			xorBytes1x16(in[off1+blockSize:], tmp1[:], out[off1+blockSize:])
+			xorBytes1x16(out[off1+blockSize:], X[:], X[:])
+		}
+		if n > 2 {
+			xorBytes1x16(in[off2+blockSize:], tmp2[:], out[off2+blockSize:])
+			xorBytes1x16(out[off2+blockSize:], X[:], X[:])
 		}
-		i++
 	}
 
 	memwipe(tmp0[:])
@@ -147,10 +186,10 @@ func (r *roundB64) aezCorePass1(e *eState, in, out []byte, X *[blockSize]byte, s
 	memwipe(I[:])
 }
 
-func (r *roundB64) aezCorePass2(e *eState, out []byte, Y, S *[blockSize]byte, sz int) {
+func (r *roundB64) aezCorePass2(e *eState, out []byte, Y, S, initialI *[blockSize]byte, sz int) {
 	var tmp0, tmp1, tmp2, tmp3, I [blockSize]byte
 
-	copy(I[:], e.I[1][:])
+	copy(I[:], initialI[:])
 	i := 1
 
 	// Process 8 * 16 bytes at a time in a loop.
@@ -203,28 +242,101 @@ func (r *roundB64) aezCorePass2(e *eState, out []byte, Y, S *[blockSize]byte, sz
 		i += 4
 	}
 
-	// XXX/performance: 4 * 16 bytes at a time.
+	// Process the remaining 1 to 3 * 32 bytes at once, discarding the
+	// unused lanes.
+	if n := sz / (2 * blockSize); n > 0 {
+		off1, off2 := laneOffsets(n, 2*blockSize)
 
-	for sz > 0 {
-		r.AES4(&e.J[1], &I, &e.L[i%8], S[:], &tmp0) // E(2,i)
+		r.aes4x4(&e.J[1], &I, &e.L[(i+0)%8], S[:], &tmp0,
+			&e.J[1], &I, &e.L[(i+1)%8], S[:], &tmp1,
+			&e.J[1], &I, &e.L[(i+2)%8], S[:], &tmp2,
+			&zero, &zero, &zero, S[:], &tmp3) // E(2,i) ... E(2,i+2)
 		xorBytes1x16(out, tmp0[:], out[:])
 		xorBytes1x16(out[blockSize:], tmp0[:], out[blockSize:])
 		xorBytes1x16(out, Y[:], Y[:])
+		if n > 1 {
+			xorBytes1x16(out[off1:], tmp1[:], out[off1:])
+			xorBytes1x16(out[off1+blockSize:], tmp1[:], out[off1+blockSize:])
+			xorBytes1x16(out[off1:], Y[:], Y[:])
+		}
+		if n > 2 {
+			xorBytes1x16(out[off2:], tmp2[:], out[off2:])
+			xorBytes1x16(out[off2+blockSize:], tmp2[:], out[off2+blockSize:])
+			xorBytes1x16(out[off2:], Y[:], Y[:])
+		}
 
-		r.AES4(&zero, &e.I[0], &e.L[0], out[blockSize:], &tmp0) // E(0,0)
+		r.aes4x4(&zero, &e.I[0], &e.L[0], out[blockSize:], &tmp0,
+			&zero, &e.I[0], &e.L[0], out[off1+blockSize:], &tmp1,
+			&zero, &e.I[0], &e.L[0], out[off2+blockSize:], &tmp2,
+			&zero, &zero, &zero, out[blockSize:], &tmp3) // E(0,0) x3
 		xorBytes1x16(out, tmp0[:], out[:])
+		if n > 1 {
+			xorBytes1x16(out[off1:], tmp1[:], out[off1:])
+		}
+		if n > 2 {
+			xorBytes1x16(out[off2:], tmp2[:], out[off2:])
+		}
 
-		r.AES4(&e.J[0], &I, &e.L[i%8], out[:], &tmp0) // E(1,i)
+		r.aes4x4(&e.J[0], &I, &e.L[(i+0)%8], out[:], &tmp0,
+			&e.J[0], &I, &e.L[(i+1)%8], out[off1:], &tmp1,
+			&e.J[0], &I, &e.L[(i+2)%8], out[off2:], &tmp2,
+			&zero, &zero, &zero, out[:], &tmp3) // E(1,i) ... E(1,i+2)
 		xorBytes1x16(out[blockSize:], tmp0[:], out[blockSize:])
-
 		swapBlocks(&tmp0, out)
+		if n > 1 {
+			xorBytes1x16(out[off1+blockSize:], tmp1[:], out[off1+blockSize:])
+			swapBlocks(&tmp0, out[off1:])
+		}
+		if n > 2 {
+			xorBytes1x16(out[off2+blockSize:], tmp2[:], out[off2+blockSize:])
+			swapBlocks(&tmp0, out[off2:])
+		}
+	}
+
+	memwipe(tmp0[:])
+	memwipe(tmp1[:])
+	memwipe(tmp2[:])
+	memwipe(tmp3[:])
+	memwipe(I[:])
+}
+
+func (r *roundB64) aezHashBlocks(e *eState, J *[blockSize]byte, in []byte, sum *[blockSize]byte) {
+	var tmp0, tmp1, tmp2, tmp3, I [blockSize]byte
+
+	copy(I[:], e.I[1][:])
+	i := 1
 
-		sz -= 2 * blockSize
-		out = out[32:]
-		if i%8 == 0 {
+	// Process 4 * 16 bytes at a time in a loop.
+	for len(in) >= 4*blockSize {
+		r.aes4x4(J, &I, &e.L[(i+0)%8], in[:], &tmp0,
+			J, &I, &e.L[(i+1)%8], in[blockSize:], &tmp1,
+			J, &I, &e.L[(i+2)%8], in[blockSize*2:], &tmp2,
+			J, &I, &e.L[(i+3)%8], in[blockSize*3:], &tmp3) // E(J,i) ... E(J,i+3)
+		xorBytes4x16(tmp0[:], tmp1[:], tmp2[:], tmp3[:], tmp0[:])
+		xorBytes1x16(sum[:], tmp0[:], sum[:])
+
+		in = in[64:]
+		if (i+3)%8 == 0 {
 			doubleBlock(&I)
 		}
-		i++
+		i += 4
+	}
+
+	// Process the remaining 1 to 3 blocks, discarding the unused lanes.
+	if n := len(in) / blockSize; n > 0 {
+		off1, off2 := laneOffsets(n, blockSize)
+
+		r.aes4x4(J, &I, &e.L[(i+0)%8], in[:], &tmp0,
+			J, &I, &e.L[(i+1)%8], in[off1:], &tmp1,
+			J, &I, &e.L[(i+2)%8], in[off2:], &tmp2,
+			&zero, &zero, &zero, in[:], &tmp3) // E(J,i) ... E(J,i+2)
+		xorBytes1x16(sum[:], tmp0[:], sum[:])
+		if n > 1 {
+			xorBytes1x16(sum[:], tmp1[:], sum[:])
+		}
+		if n > 2 {
+			xorBytes1x16(sum[:], tmp2[:], sum[:])
+		}
 	}
 
 	memwipe(tmp0[:])
@@ -234,6 +346,138 @@ func (r *roundB64) aezCorePass2(e *eState, out []byte, Y, S *[blockSize]byte, sz
 	memwipe(I[:])
 }
 
+func (r *roundB64) aezPRF(e *eState, delta *[blockSize]byte, tau int, result []byte) {
+	var ctr, src0, src1, src2, src3, tmp0, tmp1, tmp2, tmp3 [blockSize]byte
+	var buf [4 * blockSize]byte
+
+	// Process 4 * 16 bytes at a time in a loop, with the remaining 1 to 4
+	// blocks (where the final block may be partial) in the last pass.
+	for off := 0; off < tau; off += 4 * blockSize {
+		xorBytes1x16(delta[:], ctr[:], src0[:])
+		incrementCounter(&ctr)
+		xorBytes1x16(delta[:], ctr[:], src1[:])
+		incrementCounter(&ctr)
+		xorBytes1x16(delta[:], ctr[:], src2[:])
+		incrementCounter(&ctr)
+		xorBytes1x16(delta[:], ctr[:], src3[:])
+		incrementCounter(&ctr)
+
+		r.aes10x4(&e.L[3], src0[:], &tmp0,
+			src1[:], &tmp1,
+			src2[:], &tmp2,
+			src3[:], &tmp3) // E(-1,3) x4
+		copy(buf[:], tmp0[:])
+		copy(buf[blockSize:], tmp1[:])
+		copy(buf[blockSize*2:], tmp2[:])
+		copy(buf[blockSize*3:], tmp3[:])
+		copy(result[off:tau], buf[:])
+	}
+
+	memwipe(src0[:])
+	memwipe(src1[:])
+	memwipe(src2[:])
+	memwipe(src3[:])
+	memwipe(tmp0[:])
+	memwipe(tmp1[:])
+	memwipe(tmp2[:])
+	memwipe(tmp3[:])
+	memwipe(buf[:])
+}
+
+func (r *roundB64) aes4Blocks(buf []byte) {
+	var tmp0, tmp1, tmp2, tmp3 [blockSize]byte
+
+	// Process 4 * 16 bytes at a time in a loop.
+	for len(buf) >= 4*blockSize {
+		r.aes4x4(&zero, &zero, &zero, buf[:], &tmp0,
+			&zero, &zero, &zero, buf[blockSize:], &tmp1,
+			&zero, &zero, &zero, buf[blockSize*2:], &tmp2,
+			&zero, &zero, &zero, buf[blockSize*3:], &tmp3)
+		copy(buf[:], tmp0[:])
+		copy(buf[blockSize:], tmp1[:])
+		copy(buf[blockSize*2:], tmp2[:])
+		copy(buf[blockSize*3:], tmp3[:])
+
+		buf = buf[64:]
+	}
+
+	// Process the remaining 1 to 3 blocks, discarding the unused lanes.
+	if n := len(buf) / blockSize; n > 0 {
+		off1, off2 := laneOffsets(n, blockSize)
+
+		r.aes4x4(&zero, &zero, &zero, buf[:], &tmp0,
+			&zero, &zero, &zero, buf[off1:], &tmp1,
+			&zero, &zero, &zero, buf[off2:], &tmp2,
+			&zero, &zero, &zero, buf[:], &tmp3)
+		copy(buf[:], tmp0[:])
+		if n > 1 {
+			copy(buf[blockSize:], tmp1[:])
+		}
+		if n > 2 {
+			copy(buf[blockSize*2:], tmp2[:])
+		}
+	}
+
+	memwipe(tmp0[:])
+	memwipe(tmp1[:])
+	memwipe(tmp2[:])
+	memwipe(tmp3[:])
+}
+
+func (r *roundB64) aes10Blocks(buf []byte) {
+	var tmp0, tmp1, tmp2, tmp3 [blockSize]byte
+
+	// Process 4 * 16 bytes at a time in a loop.
+	for len(buf) >= 4*blockSize {
+		r.aes10x4(&zero, buf[:], &tmp0,
+			buf[blockSize:], &tmp1,
+			buf[blockSize*2:], &tmp2,
+			buf[blockSize*3:], &tmp3)
+		copy(buf[:], tmp0[:])
+		copy(buf[blockSize:], tmp1[:])
+		copy(buf[blockSize*2:], tmp2[:])
+		copy(buf[blockSize*3:], tmp3[:])
+
+		buf = buf[64:]
+	}
+
+	// Process the remaining 1 to 3 blocks, discarding the unused lanes.
+	if n := len(buf) / blockSize; n > 0 {
+		off1, off2 := laneOffsets(n, blockSize)
+
+		r.aes10x4(&zero, buf[:], &tmp0,
+			buf[off1:], &tmp1,
+			buf[off2:], &tmp2,
+			buf[:], &tmp3)
+		copy(buf[:], tmp0[:])
+		if n > 1 {
+			copy(buf[blockSize:], tmp1[:])
+		}
+		if n > 2 {
+			copy(buf[blockSize*2:], tmp2[:])
+		}
+	}
+
+	memwipe(tmp0[:])
+	memwipe(tmp1[:])
+	memwipe(tmp2[:])
+	memwipe(tmp3[:])
+}
+
+// laneOffsets returns the offsets of the second and third of n (1 to 3)
+// items of the given stride, where missing items are replaced by the first
+// item, so that every lane of a partial batch has valid input.
+func laneOffsets(n, stride int) (int, int) {
+	var off1, off2 int
+	if n > 1 {
+		off1 = stride
+	}
+	if n > 2 {
+		off2 = 2 * stride
+	}
+	return off1, off2
+}
+
 func memwipeU64(s []uint64) {
 	for i := range s {
 		s[i] = 0
@@ -0,0 +1,243 @@
+// sector.go - Length-preserving disk sector encryption.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	// SectorSize512 is the 512 byte legacy disk sector size.
+	SectorSize512 = 512
+
+	// SectorSize4096 is the 4096 byte "Advanced Format" disk sector size.
+	SectorSize4096 = 4096
+)
+
+var errInvalidSectorSize = errors.New("aez: Invalid sector size")
+
+// SectorCipher is a length-preserving disk sector cipher, intended as a
+// replacement for XTS.
+//
+// Each sector is enciphered as a single block with the AEZ wide-block
+// tweakable cipher, with the sector number (as a big endian uint64) as the
+// tweak, such that:
+//
+//   EncryptSector(n, sector) == Encrypt(key, uint64BE(n), nil, 0, sector)
+//
+// Unlike XTS, where each 16 byte block is enciphered independently, changing
+// any bit of a sector changes the entire enciphered sector, and tampering
+// with an enciphered sector results in the entire sector deciphering to
+// random garbage.  Like all length-preserving schemes, no authenticity is
+// provided, and rewriting a sector with identical contents is detectable.
+type SectorCipher struct {
+	c          Cipher
+	sectorSize int
+}
+
+// SectorSize returns the size of each sector in bytes.
+func (s *SectorCipher) SectorSize() int {
+	return s.sectorSize
+}
+
+func (s *SectorCipher) cipherSector(sectorNum uint64, buf []byte, d uint) error {
+	var tweak [1][]byte
+	var tweakBuf [8]byte
+
+	if len(buf) != s.sectorSize {
+		return errInvalidSectorSize
+	}
+
+	binary.BigEndian.PutUint64(tweakBuf[:], sectorNum)
+	tweak[0] = tweakBuf[:]
+	s.c.e.tweakedCipher(tweak[:], buf, buf, d)
+
+	return nil
+}
+
+// EncryptSector encrypts the sector with the provided sector number in place.
+// The buffer MUST be exactly SectorSize() bytes.
+func (s *SectorCipher) EncryptSector(sectorNum uint64, buf []byte) error {
+	return s.cipherSector(sectorNum, buf, 0)
+}
+
+// DecryptSector decrypts the sector with the provided sector number in place.
+// The buffer MUST be exactly SectorSize() bytes.
+func (s *SectorCipher) DecryptSector(sectorNum uint64, buf []byte) error {
+	return s.cipherSector(sectorNum, buf, 1)
+}
+
+// Reset clears the sensitive keying material from the datastructure such
+// that it will no longer be in memory.
+func (s *SectorCipher) Reset() {
+	s.c.Reset()
+}
+
+func (s *SectorCipher) init(key []byte, sectorSize int) error {
+	if len(key) == 0 {
+		return errInvalidKeySize
+	}
+	switch sectorSize {
+	case SectorSize512, SectorSize4096:
+	default:
+		return errInvalidSectorSize
+	}
+
+	s.sectorSize = sectorSize
+	s.c.e.init(key)
+	return nil
+}
+
+// NewSectorCipher returns a new SectorCipher keyed with the provided key, for
+// sectors of sectorSize bytes, which MUST be SectorSize512 or SectorSize4096.
+func NewSectorCipher(key []byte, sectorSize int) (*SectorCipher, error) {
+	s := new(SectorCipher)
+	if err := s.init(key, sectorSize); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// BlockStorage is the backing storage of a BlockDevice (eg: an *os.File
+// containing a disk image).
+type BlockStorage interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// BlockDevice is an encrypted block device, backed by a BlockStorage image
+// where each sector is encrypted with a SectorCipher.  As the encryption is
+// length-preserving, offsets into the BlockDevice are identical to offsets
+// into the image.
+//
+// Reads and writes need not be sector aligned, however unaligned writes
+// require a read-modify-write of the affected sectors.  Sectors that are
+// past the end of the image are treated as being filled with 0x00 bytes
+// when written to.  A BlockDevice is safe for concurrent use by multiple
+// goroutines.
+type BlockDevice struct {
+	sc SectorCipher
+	mu sync.RWMutex
+	s  BlockStorage
+}
+
+// readSector reads and decrypts a sector into buf.  If allowMissing is set,
+// a sector that is entirely past the end of the image is returned as 0x00
+// bytes, otherwise io.EOF is returned.
+func (b *BlockDevice) readSector(sectorNum uint64, buf []byte, allowMissing bool) error {
+	n, err := b.s.ReadAt(buf, int64(sectorNum)*int64(len(buf)))
+	switch {
+	case n == len(buf):
+	case n == 0 && (err == nil || err == io.EOF):
+		if allowMissing {
+			memwipe(buf)
+			return nil
+		}
+		return io.EOF
+	default:
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	return b.sc.DecryptSector(sectorNum, buf)
+}
+
+// ReadAt reads and decrypts len(p) bytes into p starting at offset off, per
+// the io.ReaderAt interface.
+func (b *BlockDevice) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errInvalidOffset
+	}
+
+	buf := make([]byte, b.sc.sectorSize)
+	defer memwipe(buf)
+	ss := int64(len(buf))
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	n := 0
+	for len(p) > 0 {
+		sectorNum, sOff := off/ss, off%ss
+		if err := b.readSector(uint64(sectorNum), buf, false); err != nil {
+			return n, err
+		}
+
+		copied := copy(p, buf[sOff:])
+		p = p[copied:]
+		n += copied
+		off += int64(copied)
+	}
+
+	return n, nil
+}
+
+// WriteAt encrypts and writes len(p) bytes from p starting at offset off, per
+// the io.WriterAt interface.
+func (b *BlockDevice) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errInvalidOffset
+	}
+
+	buf := make([]byte, b.sc.sectorSize)
+	defer memwipe(buf)
+	ss := int64(len(buf))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for len(p) > 0 {
+		sectorNum, sOff := off/ss, off%ss
+
+		// Partial sector writes need the existing contents of the sector.
+		if sOff != 0 || int64(len(p)) < ss {
+			if err := b.readSector(uint64(sectorNum), buf, true); err != nil {
+				return n, err
+			}
+		}
+
+		copied := copy(buf[sOff:], p)
+		if err := b.sc.EncryptSector(uint64(sectorNum), buf); err != nil {
+			return n, err
+		}
+		if _, err := b.s.WriteAt(buf, sectorNum*ss); err != nil {
+			return n, err
+		}
+		p = p[copied:]
+		n += copied
+		off += int64(copied)
+	}
+
+	return n, nil
+}
+
+// Reset clears the sensitive keying material from the datastructure such
+// that it will no longer be in memory.  The backing storage is not closed.
+func (b *BlockDevice) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sc.Reset()
+}
+
+// NewBlockDevice returns a new BlockDevice backed by the image s, keyed with
+// the provided key, for sectors of sectorSize bytes, which MUST be
+// SectorSize512 or SectorSize4096.
+func NewBlockDevice(s BlockStorage, key []byte, sectorSize int) (*BlockDevice, error) {
+	b := &BlockDevice{s: s}
+	if err := b.sc.init(key, sectorSize); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
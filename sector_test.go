@@ -0,0 +1,169 @@
+// sector_test.go - Disk sector encryption tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	mrand "math/rand"
+	"testing"
+)
+
+func TestSectorCipher(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sectorSize := range []int{SectorSize512, SectorSize4096} {
+		s, err := NewSectorCipher(key[:], sectorSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pt := make([]byte, sectorSize)
+		if _, err = rand.Read(pt); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, sectorNum := range []uint64{0, 1, 0xdeadbeef, ^uint64(0)} {
+			// Encrypting a sector is Encrypt with tau = 0, and the
+			// sector number as the nonce.
+			var nonce [8]byte
+			binary.BigEndian.PutUint64(nonce[:], sectorNum)
+			expected := Encrypt(key[:], nonce[:], nil, 0, pt, nil)
+
+			buf := append([]byte{}, pt...)
+			if err = s.EncryptSector(sectorNum, buf); err != nil {
+				t.Fatalf("[%d/%d]: EncryptSector: %v", sectorSize, sectorNum, err)
+			}
+			assertEqual(t, int(sectorNum), expected, buf)
+
+			// Decrypting under a different sector number gives garbage.
+			wrong := append([]byte{}, buf...)
+			if err = s.DecryptSector(sectorNum+1, wrong); err != nil {
+				t.Fatalf("[%d/%d]: DecryptSector: %v", sectorSize, sectorNum, err)
+			}
+			if bytes.Equal(pt, wrong) {
+				t.Fatalf("[%d/%d]: DecryptSector: accepted wrong sector number", sectorSize, sectorNum)
+			}
+
+			if err = s.DecryptSector(sectorNum, buf); err != nil {
+				t.Fatalf("[%d/%d]: DecryptSector: %v", sectorSize, sectorNum, err)
+			}
+			assertEqual(t, int(sectorNum), pt, buf)
+		}
+
+		// Flipping a single bit of the plaintext changes every 16 byte
+		// block of the ciphertext, unlike XTS.
+		a, b := append([]byte{}, pt...), append([]byte{}, pt...)
+		b[sectorSize-1] ^= 0x01
+		s.EncryptSector(0, a)
+		s.EncryptSector(0, b)
+		for i := 0; i < sectorSize; i += blockSize {
+			if bytes.Equal(a[i:i+blockSize], b[i:i+blockSize]) {
+				t.Fatalf("[%d]: EncryptSector: block %d unchanged", sectorSize, i/blockSize)
+			}
+		}
+
+		// Incorrectly sized sectors are rejected.
+		if err = s.EncryptSector(0, make([]byte, sectorSize-1)); err != errInvalidSectorSize {
+			t.Fatalf("[%d]: EncryptSector: accepted short sector: %v", sectorSize, err)
+		}
+		if err = s.DecryptSector(0, make([]byte, sectorSize+1)); err != errInvalidSectorSize {
+			t.Fatalf("[%d]: DecryptSector: accepted long sector: %v", sectorSize, err)
+		}
+
+		s.Reset()
+	}
+
+	if _, err := NewSectorCipher(key[:], 1024); err != errInvalidSectorSize {
+		t.Fatalf("NewSectorCipher: accepted invalid sector size: %v", err)
+	}
+}
+
+func TestBlockDevice(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	const imageSize = 8 * SectorSize4096
+
+	for _, sectorSize := range []int{SectorSize512, SectorSize4096} {
+		image := new(memFile)
+		d, err := NewBlockDevice(image, key[:], sectorSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Apply random writes to both the BlockDevice and an in-memory
+		// model, and ensure that the contents always match.
+		rng := mrand.New(mrand.NewSource(int64(sectorSize)))
+		model := make([]byte, imageSize)
+		if _, err = d.WriteAt(model, 0); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			off := rng.Intn(imageSize)
+			p := make([]byte, rng.Intn(imageSize-off)+1)
+			rng.Read(p)
+
+			if n, err := d.WriteAt(p, int64(off)); err != nil || n != len(p) {
+				t.Fatalf("[%d/%d]: WriteAt(%d, %d): %d %v", sectorSize, i, len(p), off, n, err)
+			}
+			copy(model[off:], p)
+
+			if len(image.b) != imageSize {
+				t.Fatalf("[%d/%d]: image size changed: %d", sectorSize, i, len(image.b))
+			}
+
+			b := make([]byte, imageSize)
+			if n, err := d.ReadAt(b, 0); err != nil || n != len(b) {
+				t.Fatalf("[%d/%d]: ReadAt: %d %v", sectorSize, i, n, err)
+			}
+			assertEqual(t, i, model, b)
+
+			off = rng.Intn(imageSize)
+			b = make([]byte, rng.Intn(imageSize-off)+1)
+			if _, err = d.ReadAt(b, int64(off)); err != nil {
+				t.Fatalf("[%d/%d]: ReadAt: %v", sectorSize, i, err)
+			}
+			assertEqual(t, i, model[off:off+len(b)], b)
+		}
+
+		// The image holds the sectors encrypted with a SectorCipher.
+		s, err := NewSectorCipher(key[:], sectorSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sector := append([]byte{}, image.b[sectorSize:2*sectorSize]...)
+		s.DecryptSector(1, sector)
+		assertEqual(t, 0, model[sectorSize:2*sectorSize], sector)
+		s.Reset()
+
+		// Reads past the end of the image return io.EOF.
+		if n, err := d.ReadAt(make([]byte, 10), imageSize-5); err != io.EOF || n != 5 {
+			t.Fatalf("[%d]: ReadAt: past end of image: %d %v", sectorSize, n, err)
+		}
+
+		// Unaligned writes past the end of the image zero-fill the sector.
+		if _, err = d.WriteAt([]byte{0x42}, imageSize+1); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 2)
+		if _, err = d.ReadAt(b, imageSize); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, 0, []byte{0x00, 0x42}, b)
+
+		d.Reset()
+	}
+}
@@ -0,0 +1,256 @@
+// stream.go - Segmented streaming AEAD.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// StreamSegmentSize is the size of each plaintext segment processed by
+	// the streaming AEAD in bytes.
+	StreamSegmentSize = 64 * 1024
+
+	// StreamTagSize is the size of the authentication tag appended to
+	// each segment by the streaming AEAD in bytes.
+	StreamTagSize = 16
+
+	streamEncSegmentSize = StreamSegmentSize + StreamTagSize
+)
+
+var errStreamClosed = errors.New("aez: stream is closed")
+
+// The streaming AEAD splits a message into segments and seals each segment
+// independently, in the style of the STREAM construction by Hoang,
+// Reyhanitabar, Rogaway, and Vizár.
+//
+// Wire format:
+//
+// The plaintext is split into segments of StreamSegmentSize bytes, with the
+// final segment being between 0 and StreamSegmentSize bytes long.  Segment i
+// (numbered from 0) is encrypted as:
+//
+//   Encrypt(key, nonce, [][]byte{uint64BE(i), {final}}, StreamTagSize, segment)
+//
+// where final is 0x01 for the last segment and 0x00 otherwise.  The encrypted
+// segments are concatenated without any additional framing, such that every
+// segment but the final one is exactly StreamSegmentSize+StreamTagSize bytes,
+// and the final segment is at least StreamTagSize bytes.  A stream always has
+// a final segment, even if it is empty.
+//
+// Binding the index and the final flag into the additional data detects
+// truncation, reordering, and duplication of segments.
+
+func streamAD(idx uint64, final bool, ad *[2][]byte, buf *[9]byte) [][]byte {
+	binary.BigEndian.PutUint64(buf[:8], idx)
+	buf[8] = 0x00
+	if final {
+		buf[8] = 0x01
+	}
+	ad[0], ad[1] = buf[:8], buf[8:]
+	return ad[:]
+}
+
+type encryptWriter struct {
+	c     Cipher
+	w     io.Writer
+	nonce []byte
+
+	pt  []byte
+	ct  []byte
+	idx uint64
+	err error
+}
+
+// Write encrypts p and writes the resulting ciphertext segments to the
+// underlying io.Writer.  Data is buffered until a segment is complete.
+func (s *encryptWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		// Only seal a full segment once it is known that it is not the
+		// final segment.
+		if len(s.pt) == StreamSegmentSize {
+			if err := s.seal(false); err != nil {
+				return n, err
+			}
+		}
+
+		toCopy := StreamSegmentSize - len(s.pt)
+		if toCopy > len(p) {
+			toCopy = len(p)
+		}
+		s.pt = append(s.pt, p[:toCopy]...)
+		p = p[toCopy:]
+		n += toCopy
+	}
+
+	return n, nil
+}
+
+// Close encrypts and writes the final segment, and clears the sensitive
+// keying material.  It does not close the underlying io.Writer.  Close MUST
+// be called or the stream will be rejected as truncated.
+func (s *encryptWriter) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	if err := s.seal(true); err != nil {
+		return err
+	}
+	s.fail(errStreamClosed)
+
+	return nil
+}
+
+func (s *encryptWriter) seal(final bool) error {
+	var ad [2][]byte
+	var adBuf [9]byte
+
+	s.ct = s.c.Encrypt(s.nonce, streamAD(s.idx, final, &ad, &adBuf), StreamTagSize, s.pt, s.ct[:0])
+	if _, err := s.w.Write(s.ct); err != nil {
+		s.fail(err)
+		return err
+	}
+	s.pt = s.pt[:0]
+	s.idx++
+
+	return nil
+}
+
+func (s *encryptWriter) fail(err error) {
+	s.err = err
+	s.c.Reset()
+	memwipe(s.pt[:cap(s.pt)])
+	s.pt = s.pt[:0]
+}
+
+// NewEncryptWriter returns an io.WriteCloser that encrypts data with the
+// streaming AEAD under the provided key and nonce, and writes the ciphertext
+// to w.  The nonce should be unique for each stream encrypted under a given
+// key.
+func NewEncryptWriter(w io.Writer, key, nonce []byte) (io.WriteCloser, error) {
+	if len(key) == 0 {
+		return nil, errInvalidKeySize
+	}
+
+	s := &encryptWriter{
+		w:     w,
+		nonce: append([]byte{}, nonce...),
+		pt:    make([]byte, 0, StreamSegmentSize),
+		ct:    make([]byte, 0, streamEncSegmentSize),
+	}
+	s.c.e.init(key)
+
+	return s, nil
+}
+
+type decryptReader struct {
+	c     Cipher
+	r     io.Reader
+	nonce []byte
+
+	ct    []byte
+	ctLen int
+	pt    []byte
+	ptOff int
+	idx   uint64
+	err   error
+}
+
+// Read reads and decrypts data from the underlying io.Reader.  Plaintext is
+// only returned once the segment containing it has been authenticated.
+func (s *decryptReader) Read(p []byte) (int, error) {
+	for s.ptOff == len(s.pt) {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.open()
+	}
+
+	n := copy(p, s.pt[s.ptOff:])
+	s.ptOff += n
+
+	return n, nil
+}
+
+func (s *decryptReader) open() {
+	var ad [2][]byte
+	var adBuf [9]byte
+
+	// Read one more byte than a full segment, to determine if the segment
+	// is the final segment.
+	n, err := io.ReadFull(s.r, s.ct[s.ctLen:])
+	s.ctLen += n
+	final := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		final = true
+	default:
+		s.fail(err)
+		return
+	}
+
+	ctLen := s.ctLen
+	if !final {
+		ctLen = streamEncSegmentSize
+	}
+
+	pt, ok := s.c.Decrypt(s.nonce, streamAD(s.idx, final, &ad, &adBuf), StreamTagSize, s.ct[:ctLen], s.pt[:0])
+	if !ok {
+		s.fail(errOpen)
+		return
+	}
+	s.pt, s.ptOff = pt, 0
+	s.idx++
+
+	if final {
+		s.fail(io.EOF)
+		return
+	}
+	s.ct[0] = s.ct[ctLen]
+	s.ctLen = 1
+}
+
+func (s *decryptReader) fail(err error) {
+	s.err = err
+	s.c.Reset()
+	memwipe(s.ct)
+	if err != io.EOF {
+		memwipe(s.pt[:cap(s.pt)])
+		s.pt, s.ptOff = s.pt[:0], 0
+	}
+}
+
+// NewDecryptReader returns an io.Reader that reads ciphertext produced by an
+// io.WriteCloser returned from NewEncryptWriter from r, and decrypts it with
+// the provided key and nonce.  The reader returns io.EOF only after the final
+// segment has been authenticated, and returns an error if the stream was
+// truncated, reordered, duplicated, or otherwise modified.
+func NewDecryptReader(r io.Reader, key, nonce []byte) (io.Reader, error) {
+	if len(key) == 0 {
+		return nil, errInvalidKeySize
+	}
+
+	s := &decryptReader{
+		r:     r,
+		nonce: append([]byte{}, nonce...),
+		ct:    make([]byte, streamEncSegmentSize+1),
+		pt:    make([]byte, 0, streamEncSegmentSize),
+	}
+	s.c.e.init(key)
+
+	return s, nil
+}
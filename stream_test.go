@@ -0,0 +1,171 @@
+// stream_test.go - Streaming AEAD tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to aez, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package aez
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func streamEncrypt(t *testing.T, key, nonce, plaintext []byte, writeSz int) []byte {
+	var buf bytes.Buffer
+
+	w, err := NewEncryptWriter(&buf, key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := plaintext; len(p) > 0; {
+		n := writeSz
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err = w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte{0x00}); err == nil {
+		t.Fatalf("Write: succeeded after Close")
+	}
+
+	return buf.Bytes()
+}
+
+func streamDecrypt(key, nonce, ciphertext []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(ciphertext), key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestStream(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sz := range []int{0, 1, StreamSegmentSize - 1, StreamSegmentSize, StreamSegmentSize + 1, 3*StreamSegmentSize + 17} {
+		plaintext := make([]byte, sz)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+
+		ciphertext := streamEncrypt(t, key[:], nonce[:], plaintext, 4093)
+		assertEqual(t, sz, ciphertext, streamEncrypt(t, key[:], nonce[:], plaintext, StreamSegmentSize*2))
+
+		// Check the wire format.
+		var expected []byte
+		var ad [2][]byte
+		var adBuf [9]byte
+		for i, p := uint64(0), plaintext; ; i++ {
+			n := len(p)
+			final := n <= StreamSegmentSize
+			if !final {
+				n = StreamSegmentSize
+			}
+			expected = Encrypt(key[:], nonce[:], streamAD(i, final, &ad, &adBuf), StreamTagSize, p[:n], expected)
+			p = p[n:]
+			if final {
+				break
+			}
+		}
+		assertEqual(t, sz, expected, ciphertext)
+
+		m, err := streamDecrypt(key[:], nonce[:], ciphertext)
+		if err != nil {
+			t.Fatalf("[%d]: decrypt failed: %v", sz, err)
+		}
+		assertEqual(t, sz, plaintext, m)
+
+		// Truncation, at and between segment boundaries.
+		for _, l := range []int{0, 1, StreamTagSize, len(ciphertext) - 1, len(ciphertext) - StreamTagSize - 1} {
+			if l < 0 || l >= len(ciphertext) {
+				continue
+			}
+			if _, err = streamDecrypt(key[:], nonce[:], ciphertext[:l]); err == nil {
+				t.Fatalf("[%d]: accepted stream truncated to %d bytes", sz, l)
+			}
+		}
+		if len(ciphertext) > streamEncSegmentSize {
+			if _, err = streamDecrypt(key[:], nonce[:], ciphertext[:streamEncSegmentSize]); err != errOpen {
+				t.Fatalf("[%d]: accepted stream truncated at a segment boundary: %v", sz, err)
+			}
+		}
+
+		// Trailing garbage.
+		if _, err = streamDecrypt(key[:], nonce[:], append(append([]byte{}, ciphertext...), 0x00)); err == nil {
+			t.Fatalf("[%d]: accepted stream with trailing data", sz)
+		}
+
+		// Incorrect nonce.
+		if _, err = streamDecrypt(key[:], nonce[:15], ciphertext); err == nil {
+			t.Fatalf("[%d]: accepted stream with incorrect nonce", sz)
+		}
+	}
+}
+
+func TestStreamReorderDuplicate(t *testing.T) {
+	var key [extractedKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+	var nonce [16]byte
+
+	plaintext := make([]byte, 3*StreamSegmentSize+1)
+	ciphertext := streamEncrypt(t, key[:], nonce[:], plaintext, len(plaintext))
+	seg := func(i int) []byte {
+		end := (i + 1) * streamEncSegmentSize
+		if end > len(ciphertext) {
+			end = len(ciphertext)
+		}
+		return ciphertext[i*streamEncSegmentSize : end]
+	}
+
+	join := func(idxs ...int) []byte {
+		var b []byte
+		for _, i := range idxs {
+			b = append(b, seg(i)...)
+		}
+		return b
+	}
+
+	if m, err := streamDecrypt(key[:], nonce[:], join(0, 1, 2, 3)); err != nil || !bytes.Equal(m, plaintext) {
+		t.Fatalf("failed to decrypt unmodified stream: %v", err)
+	}
+	for _, idxs := range [][]int{
+		{1, 0, 2, 3},    // Reordered.
+		{0, 2, 1, 3},    // Reordered.
+		{0, 0, 1, 2, 3}, // Duplicated.
+		{0, 1, 2, 2, 3}, // Duplicated.
+		{0, 1, 3},       // Dropped.
+		{0, 1, 2},       // Final segment dropped.
+		{0, 1, 2, 3, 3}, // Final segment duplicated.
+	} {
+		r, err := NewDecryptReader(bytes.NewReader(join(idxs...)), key[:], nonce[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Segments that authenticate prior to the modification may be
+		// returned, but the stream as a whole must fail.
+		if _, err = io.Copy(ioutil.Discard, r); err == nil {
+			t.Fatalf("%v: accepted modified stream", idxs)
+		}
+	}
+}